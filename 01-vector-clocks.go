@@ -1,22 +1,461 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"html"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 )
 
+// Relógio lógico de um processo. Os timestamps anexados às mensagens e
+// guardados no registro da execução são cópias do relógio do remetente.
+type Clock interface {
+	Tick(pid int)
+	Send(pid int) Clock
+	Receive(pid int, ts Clock)
+	Copy() Clock
+	String() string
+}
+
+// Relógio vetorial com um contador por processo, dimensionado em tempo de execução.
+// A posição pid-1 guarda o contador do processo pid.
+type VectorClock []int
+
 type Message struct {
 	Body      string
-	Timestamp [3]int
+	From      int
+	Timestamp Clock
+	Marker    bool // marcador do snapshot de Chandy-Lamport
+}
+
+// cria um relógio vetorial zerado para n processos
+func NewVectorClock(n int) VectorClock {
+	return make(VectorClock, n)
+}
+
+// incrementa o contador local do processo pid
+func (vc VectorClock) Tick(pid int) {
+	vc[pid-1] += 1
+}
+
+// combina o relógio local com um timestamp recebido
+func (vc VectorClock) Merge(recvTimestamp VectorClock) {
+	calcTimestamp(recvTimestamp, vc)
+}
+
+// registra um envio e devolve a cópia do relógio que acompanha a mensagem
+func (vc VectorClock) Send(pid int) Clock {
+	vc.Tick(pid)
+	return vc.Copy()
+}
+
+// registra o recebimento de uma mensagem com o timestamp recvTimestamp
+func (vc VectorClock) Receive(pid int, recvTimestamp Clock) {
+	vc.Tick(pid)
+	vc.Merge(recvTimestamp.(VectorClock))
+}
+
+func (vc VectorClock) Copy() Clock {
+	c := make(VectorClock, len(vc))
+	copy(c, vc)
+	return c
+}
+
+func (vc VectorClock) String() string {
+	return fmt.Sprint([]int(vc))
+}
+
+// Relógio escalar de Lamport
+type LamportClock struct {
+	Time int
+}
+
+func NewLamportClock() *LamportClock {
+	return &LamportClock{}
+}
+
+func (lc *LamportClock) Tick(pid int) {
+	lc.Time += 1
+}
+
+func (lc *LamportClock) Send(pid int) Clock {
+	lc.Tick(pid)
+	return lc.Copy()
+}
+
+func (lc *LamportClock) Receive(pid int, ts Clock) {
+	if recv := ts.(*LamportClock).Time; recv > lc.Time {
+		lc.Time = recv
+	}
+	lc.Tick(pid)
+}
+
+func (lc *LamportClock) Copy() Clock {
+	return &LamportClock{lc.Time}
+}
+
+func (lc *LamportClock) String() string {
+	return fmt.Sprint(lc.Time)
+}
+
+/*
+* Relógio matricial: a linha pid-1 é o relógio vetorial do próprio processo e
+* a linha j-1 é o que ele sabe sobre o relógio vetorial do processo j
+* Owner: Processo dono do relógio (usado ao combinar a matriz recebida)
+* M: Matriz n x n de contadores
+ */
+type MatrixClock struct {
+	Owner int
+	M     [][]int
+}
+
+func NewMatrixClock(n int) *MatrixClock {
+	m := make([][]int, n)
+	for i := range m {
+		m[i] = make([]int, n)
+	}
+	return &MatrixClock{M: m}
+}
+
+func (mc *MatrixClock) Tick(pid int) {
+	mc.Owner = pid
+	mc.M[pid-1][pid-1] += 1
+}
+
+func (mc *MatrixClock) Send(pid int) Clock {
+	mc.Tick(pid)
+	return mc.Copy()
+}
+
+func (mc *MatrixClock) Receive(pid int, ts Clock) {
+	recv := ts.(*MatrixClock)
+	mc.Tick(pid)
+	// a linha do próprio processo absorve o relógio vetorial do remetente
+	calcTimestamp(recv.M[recv.Owner-1], mc.M[pid-1])
+	// e todas as linhas absorvem o conhecimento do remetente sobre os demais
+	for i, row := range recv.M {
+		calcTimestamp(row, mc.M[i])
+	}
+}
+
+func (mc *MatrixClock) Copy() Clock {
+	m := make([][]int, len(mc.M))
+	for i, row := range mc.M {
+		m[i] = append([]int(nil), row...)
+	}
+	return &MatrixClock{mc.Owner, m}
+}
+
+func (mc *MatrixClock) String() string {
+	return fmt.Sprint(mc.M)
+}
+
+// número de eventos do processo j que todos os processos já conhecem. O dono
+// do relógio pode descartar (garbage collection) o que guarda sobre esses eventos
+func (mc *MatrixClock) Stable(j int) int {
+	min := mc.M[0][j-1]
+	for _, row := range mc.M[1:] {
+		if row[j-1] < min {
+			min = row[j-1]
+		}
+	}
+	return min
+}
+
+/*
+* Relógio lógico híbrido (HLC): mantém L próximo do relógio físico e usa C
+* para ordenar eventos com o mesmo L, respeitando a causalidade
+* L: Maior tempo físico conhecido (em microssegundos)
+* C: Contador lógico
+* PT: Leitura do relógio físico no último evento
+* Physical: Relógio físico do processo
+ */
+type HybridClock struct {
+	L        int64
+	C        int
+	PT       int64
+	Physical func() int64
+}
+
+func NewHybridClock(physical func() int64) *HybridClock {
+	return &HybridClock{Physical: physical}
+}
+
+// Instante de referência dos relógios físicos simulados
+var epoch = time.Now()
+
+// Defasagem máxima entre os relógios físicos simulados
+var maxSkew = 5 * time.Millisecond
+
+// relógio físico simulado, em microssegundos, adiantado skew em relação à referência
+func skewedClock(skew time.Duration) func() int64 {
+	return func() int64 {
+		return int64((time.Since(epoch) + skew) / time.Microsecond)
+	}
+}
+
+// evento local ou envio
+func (hc *HybridClock) Tick(pid int) {
+	hc.PT = hc.Physical()
+	if hc.PT > hc.L {
+		hc.L = hc.PT
+		hc.C = 0
+	} else {
+		hc.C += 1
+	}
+}
+
+func (hc *HybridClock) Send(pid int) Clock {
+	hc.Tick(pid)
+	return hc.Copy()
+}
+
+func (hc *HybridClock) Receive(pid int, ts Clock) {
+	recv := ts.(*HybridClock)
+	hc.PT = hc.Physical()
+	old := hc.L
+	hc.L = max64(old, recv.L, hc.PT)
+	switch {
+	case hc.L == old && hc.L == recv.L:
+		if recv.C > hc.C {
+			hc.C = recv.C
+		}
+		hc.C += 1
+	case hc.L == old:
+		hc.C += 1
+	case hc.L == recv.L:
+		hc.C = recv.C + 1
+	default:
+		hc.C = 0
+	}
+}
+
+func (hc *HybridClock) Copy() Clock {
+	c := *hc
+	return &c
+}
+
+func (hc *HybridClock) String() string {
+	return fmt.Sprintf("(%d,%d)", hc.L, hc.C)
+}
+
+// ordem lexicográfica (L, C) dos timestamps híbridos
+func (hc *HybridClock) Less(other *HybridClock) bool {
+	return hc.L < other.L || (hc.L == other.L && hc.C < other.C)
+}
+
+func max64(first int64, rest ...int64) int64 {
+	for _, v := range rest {
+		if v > first {
+			first = v
+		}
+	}
+	return first
+}
+
+// Tipos de relógio que podem ser escolhidos para executar o cenário
+var clockKinds = []string{"vector", "lamport", "matrix", "hybrid"}
+
+func newClock(kind string, n int) Clock {
+	switch kind {
+	case "lamport":
+		return NewLamportClock()
+	case "matrix":
+		return NewMatrixClock(n)
+	case "hybrid":
+		skew := time.Duration(rand.Int63n(int64(maxSkew) + 1))
+		return NewHybridClock(skewedClock(skew))
+	}
+	return NewVectorClock(n)
+}
+
+// Resultado da comparação entre dois timestamps vetoriais
+type Ordering int
+
+const (
+	Equal      Ordering = iota // a == b
+	Before                     // a aconteceu antes de b
+	After                      // b aconteceu antes de a
+	Concurrent                 // a e b são concorrentes
+)
+
+func (o Ordering) String() string {
+	return [...]string{"equal", "happened-before", "happened-after", "concurrent"}[o]
+}
+
+// classifica a relação de causalidade entre os timestamps a e b
+func Compare(a, b VectorClock) Ordering {
+	less, greater := false, false
+	for i := range a {
+		if a[i] < b[i] {
+			less = true
+		} else if a[i] > b[i] {
+			greater = true
+		}
+	}
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return Before
+	case greater:
+		return After
+	}
+	return Equal
+}
+
+func HappenedBefore(a, b VectorClock) bool {
+	return Compare(a, b) == Before
+}
+
+func IsConcurrent(a, b VectorClock) bool {
+	return Compare(a, b) == Concurrent
+}
+
+// Tipo de cada evento registrado na execução
+type EventKind int
+
+const (
+	LocalEvent EventKind = iota
+	SendEvent
+	ReceiveEvent
+)
+
+func (k EventKind) String() string {
+	return [...]string{"event", "send", "recv"}[k]
+}
+
+/*
+* Struct que representa um evento da execução
+* Pid: Processo onde o evento ocorreu
+* Index: Posição do evento no processo (1, 2, ...)
+* Kind: Evento local, envio ou recebimento
+* Peer: Destino (envio) ou origem (recebimento) da mensagem; 0 em eventos locais
+* Timestamp: Relógio do processo logo após o evento
+ */
+type Record struct {
+	Pid       int
+	Index     int
+	Kind      EventKind
+	Peer      int
+	Timestamp Clock
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("%s(P%d#%d)%v", r.Kind, r.Pid, r.Index, r.Timestamp)
+}
+
+// Registro de todos os eventos executados pelos processos
+type ExecutionLog struct {
+	mu      sync.Mutex
+	Records []Record
+	count   map[int]int
+}
+
+func (l *ExecutionLog) add(pid int, kind EventKind, peer int, counter Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == nil {
+		l.count = make(map[int]int)
+	}
+	l.count[pid]++
+	l.Records = append(l.Records, Record{pid, l.count[pid], kind, peer, counter.Copy()})
 }
 
-func event(pid int, counter [3]int) [3]int {
-	counter[pid-1] += 1
+// Mensagem da execução: o evento de envio e o evento de recebimento correspondente
+type Transfer struct {
+	Send, Recv Record
+}
+
+// associa cada recebimento ao seu envio. Os canais são FIFO, então o k-ésimo
+// envio de Pi para Pj é recebido pelo k-ésimo recebimento de Pj vindo de Pi
+func (l *ExecutionLog) Transfers() []Transfer {
+	sends := make(map[Link][]Record)
+	recvs := make(map[Link][]Record)
+	for _, r := range l.sorted() {
+		switch r.Kind {
+		case SendEvent:
+			sends[Link{r.Pid, r.Peer}] = append(sends[Link{r.Pid, r.Peer}], r)
+		case ReceiveEvent:
+			recvs[Link{r.Peer, r.Pid}] = append(recvs[Link{r.Peer, r.Pid}], r)
+		}
+	}
+	transfers := make([]Transfer, 0)
+	for link, list := range recvs {
+		for k, recv := range list {
+			transfers = append(transfers, Transfer{sends[link][k], recv})
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := transfers[i].Send, transfers[j].Send
+		return a.Pid < b.Pid || (a.Pid == b.Pid && a.Index < b.Index)
+	})
+	return transfers
+}
+
+// lista todos os pares de eventos concorrentes da execução. Só é possível
+// detectar concorrência quando a execução usou relógios vetoriais
+func (l *ExecutionLog) ConcurrentPairs() [][2]Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pairs := make([][2]Record, 0)
+	for i, a := range l.Records {
+		va, ok := a.Timestamp.(VectorClock)
+		if !ok {
+			break
+		}
+		for _, b := range l.Records[i+1:] {
+			if IsConcurrent(va, b.Timestamp.(VectorClock)) {
+				pairs = append(pairs, [2]Record{a, b})
+			}
+		}
+	}
+	return pairs
+}
+
+// procura o evento index do processo pid
+func (l *ExecutionLog) find(pid, index int) (Record, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.Records {
+		if r.Pid == pid && r.Index == index {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// devolve os eventos ordenados por processo e posição
+func (l *ExecutionLog) sorted() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := append([]Record(nil), l.Records...)
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Pid != records[j].Pid {
+			return records[i].Pid < records[j].Pid
+		}
+		return records[i].Index < records[j].Index
+	})
+	return records
+}
+
+func event(log *ExecutionLog, pid int, counter Clock) Clock {
+	counter.Tick(pid)
+	log.add(pid, LocalEvent, 0, counter)
 	fmt.Printf("Event in process pid=%v. Counter=%v\n", pid, counter)
 	return counter
 }
 
-func calcTimestamp(recvTimestamp, counter [3]int) [3]int {
+func calcTimestamp(recvTimestamp, counter VectorClock) VectorClock {
 	for i, num := range recvTimestamp {
 		if num > counter[i] {
 			counter[i] = num
@@ -25,60 +464,1314 @@ func calcTimestamp(recvTimestamp, counter [3]int) [3]int {
 	return counter
 }
 
-func sendMessage(ch chan Message, pid int, counter [3]int) [3]int {
-	counter[pid-1] += 1
-	ch <- Message{"Test msg!!!", counter}
+func sendMessage(log *ExecutionLog, ch chan Message, pid, to int, counter Clock) Clock {
+	ch <- Message{Body: "Test msg!!!", From: pid, Timestamp: counter.Send(pid)}
+	log.add(pid, SendEvent, to, counter)
 	fmt.Printf("Message sent from pid=%v. Counter=%v\n", pid, counter)
 	return counter
 
 }
 
-func receiveMessage(ch chan Message, pid int, counter [3]int) [3]int {
-	message := <-ch
-	counter[pid-1] += 1
-	counter = calcTimestamp(message.Timestamp, counter)
+func receiveMessage(log *ExecutionLog, message Message, pid int, counter Clock) Clock {
+	counter.Receive(pid, message.Timestamp)
+	log.add(pid, ReceiveEvent, message.From, counter)
 	fmt.Printf("Message received at pid=%v. Counter=%v\n", pid, counter)
 	return counter
 }
 
-func processOne(ch12, ch21 chan Message) {
-	pid := 1
-	var counter [3]int
-	counter = event(pid, counter)
-	counter = sendMessage(ch12, pid, counter)
-	counter = event(pid, counter)
-	counter = receiveMessage(ch21, pid, counter)
-	counter = event(pid, counter)
+/*
+* Struct que representa um processo no modo de difusão causal (Birman-Schiper-Stephenson)
+* Pid: Identifica o processo
+* Counter: Relógio vetorial; cada posição conta as difusões já entregues daquele processo
+* Inbox: Canal que recebe as mensagens difundidas pelos outros processos
+* Pending: Mensagens recebidas que aguardam a entrega das que as precedem causalmente
+* Delivered: Mensagens entregues, na ordem de entrega
+ */
+type CausalProcess struct {
+	Pid       int
+	Counter   VectorClock
+	Inbox     chan Message
+	Pending   []Message
+	Delivered []Message
+}
 
+func newCausalProcess(pid, n int) *CausalProcess {
+	return &CausalProcess{
+		Pid:     pid,
+		Counter: NewVectorClock(n),
+		Inbox:   make(chan Message, 100),
+	}
 }
 
-func processTwo(ch12, ch21, ch23, ch32 chan Message) {
-	pid := 2
-	var counter [3]int
-	counter = receiveMessage(ch12, pid, counter)
-	counter = sendMessage(ch21, pid, counter)
-	counter = sendMessage(ch23, pid, counter)
-	counter = receiveMessage(ch32, pid, counter)
+// a mensagem pode ser entregue se for a próxima do remetente e se todas as
+// mensagens que o remetente já havia entregue também foram entregues aqui
+func canDeliver(counter VectorClock, message Message) bool {
+	for i, num := range message.Timestamp.(VectorClock) {
+		if i == message.From-1 {
+			if num != counter[i]+1 {
+				return false
+			}
+		} else if num > counter[i] {
+			return false
+		}
+	}
+	return true
+}
 
+// difunde a mensagem para os demais processos, cada cópia com um atraso aleatório de até maxDelay
+func (p *CausalProcess) broadcast(procs []*CausalProcess, body string, maxDelay time.Duration) {
+	message := Message{Body: body, From: p.Pid, Timestamp: p.Counter.Send(p.Pid)}
+	p.Delivered = append(p.Delivered, message)
+	fmt.Printf("Message %s broadcast from pid=%v. Counter=%v\n", body, p.Pid, p.Counter)
+	for _, q := range procs {
+		if q.Pid == p.Pid {
+			continue
+		}
+		delay := time.Duration(rand.Int63n(int64(maxDelay) + 1))
+		go func(inbox chan Message, delay time.Duration) {
+			time.Sleep(delay)
+			inbox <- message
+		}(q.Inbox, delay)
+	}
 }
 
-func processThree(ch23, ch32 chan Message) {
-	pid := 3
-	var counter [3]int
-	counter = receiveMessage(ch23, pid, counter)
-	counter = sendMessage(ch32, pid, counter)
+// recebe a próxima mensagem do canal e entrega todas as pendentes que a
+// condição causal permitir. Retorna o número de mensagens entregues
+func (p *CausalProcess) receive() int {
+	message := <-p.Inbox
+	p.Pending = append(p.Pending, message)
+	if !canDeliver(p.Counter, message) {
+		fmt.Printf("Message %s buffered at pid=%v. Timestamp=%v Counter=%v\n", message.Body, p.Pid, message.Timestamp, p.Counter)
+	}
+
+	delivered := 0
+	for progress := true; progress; {
+		progress = false
+		for i, m := range p.Pending {
+			if canDeliver(p.Counter, m) {
+				p.Counter = calcTimestamp(m.Timestamp.(VectorClock), p.Counter)
+				p.Delivered = append(p.Delivered, m)
+				p.Pending = append(p.Pending[:i], p.Pending[i+1:]...)
+				fmt.Printf("Message %s delivered at pid=%v. Counter=%v\n", m.Body, p.Pid, p.Counter)
+				delivered++
+				progress = true
+				break
+			}
+		}
+	}
+	return delivered
+}
+
+func causalProcess(w *sync.WaitGroup, procs []*CausalProcess, p *CausalProcess, rounds int, maxDelay time.Duration) {
+
+	defer w.Done()
+
+	others := (len(procs) - 1) * rounds // difusões esperadas dos outros processos
+	for r := 1; r <= rounds; r++ {
+		p.broadcast(procs, fmt.Sprintf("m%d.%d", p.Pid, r), maxDelay)
+		// espera ao menos uma nova entrega antes da próxima difusão, para que as
+		// rodadas fiquem causalmente encadeadas entre os processos
+		for delivered := 0; delivered == 0 && len(p.Delivered)-r < others; {
+			delivered = p.receive()
+		}
+	}
+	for len(p.Delivered) < others+rounds {
+		p.receive()
+	}
+}
+
+// verifica se a ordem de entrega em cada processo respeita a relação happened-before
+func checkCausalOrder(procs []*CausalProcess) bool {
+	ok := true
+	for _, p := range procs {
+		for i, m := range p.Delivered {
+			for _, later := range p.Delivered[i+1:] {
+				if HappenedBefore(later.Timestamp.(VectorClock), m.Timestamp.(VectorClock)) {
+					fmt.Printf("Causal order violated at pid=%v: %s delivered before %s\n", p.Pid, m.Body, later.Body)
+					ok = false
+				}
+			}
+		}
+	}
+	return ok
+}
+
+// executa n processos que difundem rounds mensagens cada com entrega causal e
+// devolve os processos com as mensagens na ordem em que cada um as entregou
+func runCausalBroadcast(n, rounds int, maxDelay time.Duration) []*CausalProcess {
+	procs := make([]*CausalProcess, n)
+	for i := range procs {
+		procs[i] = newCausalProcess(i+1, n)
+	}
+
+	var w sync.WaitGroup
+	for _, p := range procs {
+		w.Add(1)
+		go causalProcess(&w, procs, p, rounds, maxDelay)
+	}
+	w.Wait()
+
+	for _, p := range procs {
+		order := make([]string, len(p.Delivered))
+		for i, m := range p.Delivered {
+			order[i] = m.Body
+		}
+		fmt.Printf("Delivery order at pid=%v: %v\n", p.Pid, order)
+	}
+	if checkCausalOrder(procs) {
+		fmt.Println("Causal order respected in every process.")
+	}
+	return procs
+}
+
+// Cenário padrão: a execução de três processos apresentada nas notas de aula
+const defaultScenario = `
+P1: event; send P2; event; recv P2; event
+P2: recv P1; send P1; send P3; recv P3
+P3: recv P2; send P2
+`
+
+// Operações que um processo pode executar no cenário
+const (
+	OpEvent = "event"
+	OpSend  = "send"
+	OpRecv  = "recv"
+	// inicia um snapshot global de Chandy-Lamport
+	OpSnapshot = "snapshot"
+)
+
+/*
+* Struct que representa um passo do cenário
+* Op: Evento local, envio ou recebimento
+* Peer: Processo de destino (send) ou de origem (recv)
+ */
+type Step struct {
+	Op   string
+	Peer int
+}
+
+// Canal de comunicação do processo From para o processo To
+type Link struct {
+	From, To int
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("P%d->P%d", l.From, l.To)
+}
+
+/*
+* Struct que representa um diagrama espaço-tempo
+* Scripts: Passos de cada processo; a posição pid-1 guarda os passos do processo pid
+ */
+type Scenario struct {
+	Scripts [][]Step
+}
+
+// número de processos do cenário
+func (sc *Scenario) Size() int {
+	return len(sc.Scripts)
+}
+
+// interpreta o identificador de um processo ("P1", "p2", ...)
+func parsePid(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || (s[0] != 'P' && s[0] != 'p') {
+		return 0, fmt.Errorf("invalid process %q", s)
+	}
+	pid, err := strconv.Atoi(s[1:])
+	if err != nil || pid < 1 {
+		return 0, fmt.Errorf("invalid process %q", s)
+	}
+	return pid, nil
+}
+
+/*
+* Lê um cenário no formato texto, uma linha por processo:
+*   P1: event; send P2; recv P2
+* Linhas vazias e iniciadas por # são ignoradas. Várias linhas do mesmo
+* processo são concatenadas. O número de processos é o maior pid citado.
+ */
+func parseScenario(r io.Reader) (*Scenario, error) {
+	sc := &Scenario{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sep := strings.Index(text, ":")
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: missing ':' after the process", line)
+		}
+		pid, err := parsePid(text[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		sc.grow(pid)
+		for _, field := range strings.Split(text[sep+1:], ";") {
+			words := strings.Fields(field)
+			if len(words) == 0 {
+				continue
+			}
+			step := Step{Op: strings.ToLower(words[0])}
+			switch step.Op {
+			case OpEvent, OpSnapshot:
+				if len(words) != 1 {
+					return nil, fmt.Errorf("line %d: %q takes no arguments", line, field)
+				}
+			case OpSend, OpRecv, "receive":
+				if len(words) != 2 {
+					return nil, fmt.Errorf("line %d: %q needs exactly one process", line, field)
+				}
+				if step.Peer, err = parsePid(words[1]); err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				if step.Peer == pid {
+					return nil, fmt.Errorf("line %d: P%d cannot talk to itself", line, pid)
+				}
+				if step.Op == "receive" {
+					step.Op = OpRecv
+				}
+				sc.grow(step.Peer)
+			default:
+				return nil, fmt.Errorf("line %d: unknown operation %q", line, words[0])
+			}
+			sc.Scripts[pid-1] = append(sc.Scripts[pid-1], step)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if sc.Size() == 0 {
+		return nil, fmt.Errorf("empty scenario")
+	}
+	return sc, nil
+}
+
+// garante que o cenário tenha pelo menos n processos
+func (sc *Scenario) grow(n int) {
+	for len(sc.Scripts) < n {
+		sc.Scripts = append(sc.Scripts, nil)
+	}
+}
+
+// verifica, antes da execução, se cada recebimento tem um envio correspondente no mesmo canal
+func (sc *Scenario) validate() error {
+	sends := make(map[Link]int)
+	recvs := make(map[Link]int)
+	for i, script := range sc.Scripts {
+		for _, step := range script {
+			switch step.Op {
+			case OpSend:
+				sends[Link{i + 1, step.Peer}]++
+			case OpRecv:
+				recvs[Link{step.Peer, i + 1}]++
+			}
+		}
+	}
+	problems := make([]string, 0)
+	for i := range sc.Scripts {
+		for j := range sc.Scripts {
+			link := Link{j + 1, i + 1}
+			if recvs[link] > sends[link] {
+				problems = append(problems, fmt.Sprintf("P%d receives %d message(s) from P%d, which sends only %d", link.To, recvs[link], link.From, sends[link]))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unmatched receives:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// indica se algum processo inicia um snapshot global
+func (sc *Scenario) HasSnapshot() bool {
+	for _, script := range sc.Scripts {
+		for _, step := range script {
+			if step.Op == OpSnapshot {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cria um canal para cada par de processos que se comunica, com espaço para
+// todas as mensagens enviadas nele e para o marcador do snapshot
+func (sc *Scenario) links() map[Link]chan Message {
+	sends := make(map[Link]int)
+	for i, script := range sc.Scripts {
+		for _, step := range script {
+			switch step.Op {
+			case OpSend:
+				sends[Link{i + 1, step.Peer}]++
+			case OpRecv:
+				// o canal existe mesmo que ninguém envie nele
+				if _, ok := sends[Link{step.Peer, i + 1}]; !ok {
+					sends[Link{step.Peer, i + 1}] = 0
+				}
+			}
+		}
+	}
+	links := make(map[Link]chan Message)
+	for link, count := range sends {
+		links[link] = make(chan Message, count+1)
+	}
+	return links
+}
+
+// Ponto em que um processo está bloqueado: passo Step do script, esperando mensagem no canal Link
+type Wait struct {
+	Step int
+	Link Link
+}
+
+/*
+* Struct que acompanha o progresso dos processos de um cenário
+* Pending: Envios menos recebimentos iniciados em cada canal (negativo quando há processo esperando)
+* Blocked: Processos esperando por uma mensagem que ainda não foi enviada
+* Finished: Processos que executaram todos os passos
+* Running: Número de processos que ainda não terminaram
+ */
+type Tracker struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	Pending  map[Link]int
+	Blocked  map[int]Wait
+	Finished []int
+	Running  int
+	aborted  bool
+	done     chan struct{} // fechado quando a execução é abortada
+}
+
+func newTracker(n int) *Tracker {
+	t := &Tracker{
+		Pending: make(map[Link]int),
+		Blocked: make(map[int]Wait),
+		Running: n,
+		done:    make(chan struct{}),
+	}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// registra um envio no canal link, liberando o destinatário se ele esperava por essa mensagem
+func (t *Tracker) sent(link Link) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Pending[link]++
+	if wait, ok := t.Blocked[link.To]; ok && wait.Link == link && t.Pending[link] >= 0 {
+		delete(t.Blocked, link.To)
+		t.cond.Broadcast()
+	}
+}
+
+// reserva a próxima mensagem do canal link para o processo pid, esperando que ela seja enviada.
+// Retorna false se a execução foi abortada porque nenhum processo pode mais enviá-la
+func (t *Tracker) await(pid, step int, link Link) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Pending[link]--
+	if t.Pending[link] >= 0 {
+		return true
+	}
+	t.Blocked[pid] = Wait{step, link}
+	t.check()
+	for {
+		if _, ok := t.Blocked[pid]; !ok {
+			return true
+		}
+		if t.aborted {
+			return false
+		}
+		t.cond.Wait()
+	}
+}
 
+// registra o fim do processo pid
+func (t *Tracker) finish(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Running--
+	t.Finished = append(t.Finished, pid)
+	t.check()
+}
+
+// aborta a execução quando todos os processos restantes estão bloqueados
+func (t *Tracker) check() {
+	if t.Running > 0 && len(t.Blocked) == t.Running {
+		t.aborted = true
+		t.cond.Broadcast()
+		close(t.done)
+	}
+}
+
+// Erro que descreve uma execução que não pode terminar
+type DeadlockError struct {
+	Finished []int
+	Blocked  map[int]Wait
+	Scripts  [][]Step
+}
+
+func (e *DeadlockError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "execution cannot complete\n  finished: %v", pids(e.Finished))
+	blocked := make([]int, 0, len(e.Blocked))
+	for pid := range e.Blocked {
+		blocked = append(blocked, pid)
+	}
+	sort.Ints(blocked)
+	for _, pid := range blocked {
+		wait := e.Blocked[pid]
+		step := e.Scripts[pid-1][wait.Step]
+		fmt.Fprintf(&b, "\n  P%d blocked at step %d (%s P%d) waiting on channel %v", pid, wait.Step+1, step.Op, step.Peer, wait.Link)
+	}
+	return b.String()
+}
+
+// formata uma lista de processos como [P1 P2 ...]
+func pids(list []int) string {
+	sorted := append([]int(nil), list...)
+	sort.Ints(sorted)
+	names := make([]string, len(sorted))
+	for i, pid := range sorted {
+		names[i] = fmt.Sprintf("P%d", pid)
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// Estado local registrado no snapshot: quantos eventos o processo já havia executado e seu relógio
+type LocalState struct {
+	Events  int
+	Counter Clock
+}
+
+/*
+* Struct que guarda o snapshot global de Chandy-Lamport
+* States: Estado local registrado por cada processo
+* Channels: Mensagens em trânsito registradas em cada canal
+ */
+type Snapshot struct {
+	mu       sync.Mutex
+	States   map[int]LocalState
+	Channels map[Link][]Message
+}
+
+func newSnapshot() *Snapshot {
+	return &Snapshot{
+		States:   make(map[int]LocalState),
+		Channels: make(map[Link][]Message),
+	}
+}
+
+/*
+* Struct que representa a participação de um processo no snapshot
+* Recorded: Indica se o processo já registrou seu estado local
+* Open: Canais de entrada cujo marcador ainda não chegou (mensagens recebidas neles são registradas)
+ */
+type snapshotter struct {
+	snap     *Snapshot
+	pid      int
+	links    map[Link]chan Message
+	Recorded bool
+	Open     map[Link]bool
+}
+
+func newSnapshotter(snap *Snapshot, pid int, links map[Link]chan Message) *snapshotter {
+	return &snapshotter{snap: snap, pid: pid, links: links, Open: make(map[Link]bool)}
+}
+
+// registra o estado local, passa a registrar todos os canais de entrada e envia o marcador em todos os canais de saída
+func (sn *snapshotter) record(events int, counter Clock) {
+	if sn.Recorded {
+		return
+	}
+	sn.Recorded = true
+	sn.snap.mu.Lock()
+	sn.snap.States[sn.pid] = LocalState{events, counter.Copy()}
+	sn.snap.mu.Unlock()
+	fmt.Printf("Snapshot recorded at pid=%v. Counter=%v\n", sn.pid, counter)
+
+	for link, ch := range sn.links {
+		if link.To == sn.pid {
+			sn.Open[link] = true
+		}
+		if link.From == sn.pid {
+			ch <- Message{From: sn.pid, Marker: true}
+		}
+	}
+}
+
+// trata uma mensagem lida do canal link: o marcador encerra o registro do
+// canal e uma mensagem comum entra no estado do canal enquanto ele estiver aberto
+func (sn *snapshotter) receive(link Link, message Message, events int, counter Clock) {
+	if message.Marker {
+		sn.record(events, counter)
+		delete(sn.Open, link)
+		return
+	}
+	if sn.Recorded && sn.Open[link] {
+		sn.snap.mu.Lock()
+		sn.snap.Channels[link] = append(sn.snap.Channels[link], message)
+		sn.snap.mu.Unlock()
+	}
+}
+
+// executa os passos do processo pid no cenário
+func process(w *sync.WaitGroup, t *Tracker, snap *Snapshot, log *ExecutionLog, pid int, counter Clock, script []Step, links map[Link]chan Message) {
+
+	defer w.Done()
+
+	var sn *snapshotter
+	if snap != nil {
+		sn = newSnapshotter(snap, pid, links)
+	}
+	events := 0
+
+	for i, step := range script {
+		switch step.Op {
+		case OpEvent:
+			counter = event(log, pid, counter)
+			events++
+		case OpSend:
+			link := Link{pid, step.Peer}
+			t.sent(link)
+			counter = sendMessage(log, links[link], pid, step.Peer, counter)
+			events++
+		case OpRecv:
+			link := Link{step.Peer, pid}
+			if !t.await(pid, i, link) {
+				return
+			}
+			// os marcadores que chegam antes da mensagem são tratados pelo snapshot
+			message := <-links[link]
+			for message.Marker {
+				sn.receive(link, message, events, counter)
+				message = <-links[link]
+			}
+			if sn != nil {
+				sn.receive(link, message, events, counter)
+			}
+			counter = receiveMessage(log, message, pid, counter)
+			events++
+		case OpSnapshot:
+			sn.record(events, counter)
+		}
+	}
+	t.finish(pid)
+
+	if sn == nil {
+		return
+	}
+	// Ao fim do script o processo registra seu estado (se ainda não o fez) e
+	// espera o marcador em cada canal de entrada; mensagens que nunca seriam
+	// recebidas pelo script ficam no estado do canal
+	sn.record(events, counter)
+	for link := range sn.Open {
+		for sn.Open[link] {
+			select {
+			case message := <-links[link]:
+				sn.receive(link, message, events, counter)
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
+
+// executa o cenário com o tipo de relógio escolhido. Retorna *DeadlockError se
+// algum processo ficou esperando por uma mensagem que nunca seria enviada.
+// Se o cenário contém o passo snapshot, retorna também o snapshot global registrado
+func runScenario(sc *Scenario, kind string) (*ExecutionLog, *Snapshot, error) {
+	var log ExecutionLog
+	var snap *Snapshot
+	if sc.HasSnapshot() {
+		snap = newSnapshot()
+	}
+	links := sc.links()
+	t := newTracker(sc.Size())
+
+	var w sync.WaitGroup
+	for i, script := range sc.Scripts {
+		w.Add(1)
+		go process(&w, t, snap, &log, i+1, newClock(kind, sc.Size()), script, links)
+	}
+	w.Wait()
+
+	if t.aborted {
+		return &log, nil, &DeadlockError{t.Finished, t.Blocked, sc.Scripts}
+	}
+	fmt.Printf("All processes finished: %s\n", pids(t.Finished))
+	for link, count := range t.Pending {
+		if count > 0 {
+			fmt.Printf("Warning: %d message(s) on channel %v were never received\n", count, link)
+		}
+	}
+	return &log, snap, nil
+}
+
+// imprime o snapshot e verifica se ele é um corte consistente da execução:
+// nenhum processo conhece mais eventos de Pi do que Pi registrou (relógios
+// vetoriais) e cada canal guarda exatamente as mensagens enviadas antes do
+// corte do remetente e recebidas depois do corte do destinatário
+func checkSnapshot(snap *Snapshot, log *ExecutionLog) bool {
+	fmt.Println("Snapshot:")
+	n := len(snap.States)
+	for pid := 1; pid <= n; pid++ {
+		state := snap.States[pid]
+		fmt.Printf("  P%d: events=%d counter=%v\n", pid, state.Events, state.Counter)
+	}
+
+	// mensagens enviadas antes do corte do remetente e não recebidas antes do corte do destinatário
+	inTransit := make(map[Link]int)
+	for _, r := range log.sorted() {
+		before := r.Index <= snap.States[r.Pid].Events
+		switch {
+		case r.Kind == SendEvent && before:
+			inTransit[Link{r.Pid, r.Peer}]++
+		case r.Kind == ReceiveEvent && before:
+			inTransit[Link{r.Peer, r.Pid}]--
+		}
+	}
+	for link := range inTransit {
+		if _, ok := snap.Channels[link]; !ok {
+			snap.Channels[link] = nil
+		}
+	}
+	links := make([]Link, 0, len(snap.Channels))
+	for link := range snap.Channels {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].From < links[j].From || (links[i].From == links[j].From && links[i].To < links[j].To)
+	})
+
+	ok := true
+	for _, t := range log.Transfers() {
+		sent := t.Send.Index <= snap.States[t.Send.Pid].Events
+		received := t.Recv.Index <= snap.States[t.Recv.Pid].Events
+		if received && !sent {
+			fmt.Printf("Inconsistent cut: %v received before the cut but sent after it\n", t.Recv)
+			ok = false
+		}
+	}
+	for _, link := range links {
+		messages := snap.Channels[link]
+		stamps := make([]string, len(messages))
+		for i, m := range messages {
+			stamps[i] = m.Timestamp.String()
+		}
+		fmt.Printf("  channel %v: %v\n", link, stamps)
+		if len(messages) != inTransit[link] {
+			fmt.Printf("Inconsistent cut: channel %v should hold %d message(s)\n", link, inTransit[link])
+			ok = false
+		}
+	}
+
+	for i := 1; i <= n; i++ {
+		vi, vector := snap.States[i].Counter.(VectorClock)
+		if !vector {
+			break
+		}
+		for j := 1; j <= n; j++ {
+			if vj := snap.States[j].Counter.(VectorClock); vj[i-1] > vi[i-1] {
+				fmt.Printf("Inconsistent cut: P%d knows %d event(s) of P%d, which recorded only %d\n", j, vj[i-1], i, vi[i-1])
+				ok = false
+			}
+		}
+	}
+	if ok {
+		fmt.Println("Snapshot is a consistent cut.")
+	}
+	return ok
+}
+
+// lê o cenário do arquivo informado ou, se path for vazio, usa o cenário padrão
+func loadScenario(path string) (*Scenario, error) {
+	if path == "" {
+		return parseScenario(strings.NewReader(defaultScenario))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseScenario(f)
+}
+
+// descartes permitidos pelo relógio matricial: eventos dos outros processos que todos já conhecem
+func garbageCollectable(r Record) string {
+	mc, ok := r.Timestamp.(*MatrixClock)
+	if !ok {
+		return ""
+	}
+	gc := make([]string, 0)
+	for j := 1; j <= len(mc.M); j++ {
+		if stable := mc.Stable(j); j != r.Pid && stable > 0 {
+			gc = append(gc, fmt.Sprintf("P%d#1-%d", j, stable))
+		}
+	}
+	return strings.Join(gc, " ")
+}
+
+// imprime lado a lado os timestamps de cada evento em cada tipo de relógio
+func printComparison(logs map[string]*ExecutionLog) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "event\t%s\tmatrix gc\n", strings.Join(clockKinds, "\t"))
+	for _, r := range logs[clockKinds[0]].sorted() {
+		fmt.Fprintf(tw, "%s(P%d#%d)", r.Kind, r.Pid, r.Index)
+		for _, kind := range clockKinds {
+			other, _ := logs[kind].find(r.Pid, r.Index)
+			fmt.Fprintf(tw, "\t%v", other.Timestamp)
+		}
+		matrix, _ := logs["matrix"].find(r.Pid, r.Index)
+		fmt.Fprintf(tw, "\t%s\n", garbageCollectable(matrix))
+	}
+	tw.Flush()
+}
+
+// verifica as propriedades do HLC na execução: L nunca fica atrás do relógio
+// físico nem se afasta dele mais que a defasagem máxima, e cada evento tem
+// timestamp maior que os eventos que o precedem causalmente
+func checkHybridClock(log *ExecutionLog, bound time.Duration) bool {
+	ok := true
+	eps := int64(bound / time.Microsecond)
+	drift := int64(0)
+	records := log.sorted()
+	for i, r := range records {
+		hc := r.Timestamp.(*HybridClock)
+		if d := hc.L - hc.PT; d < 0 || d > eps {
+			fmt.Printf("HLC drift violated at P%d#%d: l=%d pt=%d\n", r.Pid, r.Index, hc.L, hc.PT)
+			ok = false
+		} else if d > drift {
+			drift = d
+		}
+		if i > 0 && records[i-1].Pid == r.Pid && !records[i-1].Timestamp.(*HybridClock).Less(hc) {
+			fmt.Printf("HLC causality violated between %v and %v\n", records[i-1], r)
+			ok = false
+		}
+	}
+	for _, t := range log.Transfers() {
+		if !t.Send.Timestamp.(*HybridClock).Less(t.Recv.Timestamp.(*HybridClock)) {
+			fmt.Printf("HLC causality violated between %v and %v\n", t.Send, t.Recv)
+			ok = false
+		}
+	}
+	if ok {
+		fmt.Printf("HLC bounds respected: max l-pt = %dus (bound %dus)\n", drift, eps)
+	}
+	return ok
+}
+
+/*
+* Estado global correspondente a um corte da execução
+* Cut: Número de eventos de cada processo incluídos no corte
+* Counters: Relógio vetorial de cada processo no corte
+* Total: Número de eventos de cada processo na execução completa
+ */
+type GlobalState struct {
+	Cut      []int
+	Counters []VectorClock
+	Total    []int
+}
+
+// Predicado global avaliado sobre os estados do reticulado de cortes consistentes
+type Predicate func(g GlobalState) bool
+
+// Analisador offline dos timestamps vetoriais de uma execução.
+// Events[i][k] é o timestamp do evento k+1 do processo i+1
+type Analyzer struct {
+	Events [][]VectorClock
+}
+
+func newAnalyzer(log *ExecutionLog, n int) (*Analyzer, error) {
+	a := &Analyzer{Events: make([][]VectorClock, n)}
+	for _, r := range log.sorted() {
+		vc, ok := r.Timestamp.(VectorClock)
+		if !ok {
+			return nil, fmt.Errorf("cut analysis requires vector clocks")
+		}
+		a.Events[r.Pid-1] = append(a.Events[r.Pid-1], vc)
+	}
+	return a, nil
+}
+
+// um corte é consistente se nenhum processo conhece, pelo seu relógio, mais
+// eventos de outro processo do que os incluídos no corte
+func (a *Analyzer) IsConsistent(cut []int) bool {
+	if len(cut) != len(a.Events) {
+		return false
+	}
+	for i, k := range cut {
+		if k < 0 || k > len(a.Events[i]) {
+			return false
+		}
+		if k == 0 {
+			continue
+		}
+		for j, num := range a.Events[i][k-1] {
+			if num > cut[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (a *Analyzer) state(cut []int) GlobalState {
+	g := GlobalState{Cut: cut, Counters: make([]VectorClock, len(cut)), Total: make([]int, len(cut))}
+	for i, k := range cut {
+		g.Total[i] = len(a.Events[i])
+		if k == 0 {
+			g.Counters[i] = NewVectorClock(len(cut))
+		} else {
+			g.Counters[i] = a.Events[i][k-1]
+		}
+	}
+	return g
+}
+
+// cortes consistentes alcançáveis a partir de cut executando um evento a mais
+func (a *Analyzer) successors(cut []int) [][]int {
+	next := make([][]int, 0)
+	for i := range cut {
+		succ := append([]int(nil), cut...)
+		succ[i]++
+		if a.IsConsistent(succ) {
+			next = append(next, succ)
+		}
+	}
+	return next
+}
+
+// percorre em largura os cortes consistentes a partir do corte inicial, sem
+// passar dos cortes rejeitados por skip. Retorna os cortes visitados por nível
+func (a *Analyzer) walk(skip Predicate) [][][]int {
+	levels := make([][][]int, 0)
+	level := [][]int{make([]int, len(a.Events))}
+	seen := make(map[string]bool)
+	for len(level) > 0 {
+		current := make([][]int, 0)
+		next := make([][]int, 0)
+		for _, cut := range level {
+			if seen[fmt.Sprint(cut)] || (skip != nil && skip(a.state(cut))) {
+				continue
+			}
+			seen[fmt.Sprint(cut)] = true
+			current = append(current, cut)
+			next = append(next, a.successors(cut)...)
+		}
+		if len(current) > 0 {
+			levels = append(levels, current)
+		}
+		level = next
+	}
+	return levels
+}
+
+// reticulado de cortes consistentes, organizado por número total de eventos
+func (a *Analyzer) Lattice() [][][]int {
+	return a.walk(nil)
+}
+
+// Possibly(p): algum corte consistente satisfaz p. Retorna o primeiro corte encontrado
+func (a *Analyzer) Possibly(p Predicate) ([]int, bool) {
+	for _, level := range a.Lattice() {
+		for _, cut := range level {
+			if p(a.state(cut)) {
+				return cut, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Definitely(p): todo caminho do corte inicial ao final passa por um corte que satisfaz p.
+// Basta verificar se o corte final é alcançável usando apenas cortes que não satisfazem p
+func (a *Analyzer) Definitely(p Predicate) bool {
+	final := make([]int, len(a.Events))
+	for i, events := range a.Events {
+		final[i] = len(events)
+	}
+	for _, level := range a.walk(p) {
+		for _, cut := range level {
+			if fmt.Sprint(cut) == fmt.Sprint(final) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lê um corte no formato "2,4,1"
+func parseCut(text string) ([]int, error) {
+	fields := strings.Split(text, ",")
+	cut := make([]int, len(fields))
+	for i, field := range fields {
+		k, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cut %q", text)
+		}
+		cut[i] = k
+	}
+	return cut, nil
+}
+
+/*
+* Lê um predicado global formado por termos ligados por && e || (&& tem
+* precedência). Cada termo pode ser negado com ! e é um destes:
+*   Pi.counter OP n     contador do próprio Pi (eventos executados)
+*   Pi.counter[j] OP n  quantos eventos de Pj o Pi conhece
+*   Pi.idle             Pi ainda não começou ou já terminou seus eventos
+*   Pi.done             Pi já executou todos os seus eventos
+* OP é um de <, <=, >, >=, ==, !=
+ */
+func parsePredicate(expr string, n int) (Predicate, error) {
+	any := make([]Predicate, 0)
+	for _, disjunct := range strings.Split(expr, "||") {
+		all := make([]Predicate, 0)
+		for _, term := range strings.Split(disjunct, "&&") {
+			p, err := parseTerm(strings.TrimSpace(term), n)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, p)
+		}
+		any = append(any, func(g GlobalState) bool {
+			for _, p := range all {
+				if !p(g) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return func(g GlobalState) bool {
+		for _, p := range any {
+			if p(g) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func parseTerm(term string, n int) (Predicate, error) {
+	if strings.HasPrefix(term, "!") {
+		p, err := parseTerm(strings.TrimSpace(term[1:]), n)
+		if err != nil {
+			return nil, err
+		}
+		return func(g GlobalState) bool { return !p(g) }, nil
+	}
+	dot := strings.Index(term, ".")
+	if dot < 0 {
+		return nil, fmt.Errorf("invalid term %q", term)
+	}
+	pid, err := parsePid(term[:dot])
+	if err != nil || pid > n {
+		return nil, fmt.Errorf("invalid process in term %q", term)
+	}
+	i := pid - 1
+	attr := strings.TrimSpace(term[dot+1:])
+	switch attr {
+	case "idle":
+		return func(g GlobalState) bool { return g.Cut[i] == 0 || g.Cut[i] == g.Total[i] }, nil
+	case "done":
+		return func(g GlobalState) bool { return g.Cut[i] == g.Total[i] }, nil
+	}
+
+	fields := strings.Fields(attr)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "counter") {
+		return nil, fmt.Errorf("invalid term %q", term)
+	}
+	j := i
+	if index := strings.TrimPrefix(fields[0], "counter"); index != "" {
+		if !strings.HasPrefix(index, "[") || !strings.HasSuffix(index, "]") {
+			return nil, fmt.Errorf("invalid term %q", term)
+		}
+		k, err := strconv.Atoi(index[1 : len(index)-1])
+		if err != nil || k < 1 || k > n {
+			return nil, fmt.Errorf("invalid process index in term %q", term)
+		}
+		j = k - 1
+	}
+	value, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid number in term %q", term)
+	}
+	compare := map[string]func(a, b int) bool{
+		"<":  func(a, b int) bool { return a < b },
+		"<=": func(a, b int) bool { return a <= b },
+		">":  func(a, b int) bool { return a > b },
+		">=": func(a, b int) bool { return a >= b },
+		"==": func(a, b int) bool { return a == b },
+		"!=": func(a, b int) bool { return a != b },
+	}[fields[1]]
+	if compare == nil {
+		return nil, fmt.Errorf("invalid operator in term %q", term)
+	}
+	return func(g GlobalState) bool { return compare(g.Counters[i][j], value) }, nil
+}
+
+// Identifica um evento: a posição Index no processo Pid
+type EventId struct {
+	Pid, Index int
+}
+
+// coluna de cada evento no diagrama espaço-tempo: o tamanho da maior cadeia
+// causal que termina no evento, para que toda mensagem aponte para a direita
+func layout(records []Record, transfers []Transfer) map[EventId]int {
+	sendOf := make(map[EventId]EventId)
+	for _, t := range transfers {
+		sendOf[EventId{t.Recv.Pid, t.Recv.Index}] = EventId{t.Send.Pid, t.Send.Index}
+	}
+	x := make(map[EventId]int)
+	for changed := true; changed; {
+		changed = false
+		for _, r := range records {
+			id := EventId{r.Pid, r.Index}
+			col := x[EventId{r.Pid, r.Index - 1}] + 1
+			if send, ok := sendOf[id]; ok && x[send]+1 > col {
+				col = x[send] + 1
+			}
+			if col != x[id] {
+				x[id] = col
+				changed = true
+			}
+		}
+	}
+	return x
+}
+
+// exporta a execução como diagrama espaço-tempo em SVG: uma linha horizontal
+// por processo, um ponto por evento rotulado com o timestamp e uma seta por mensagem
+func writeSVG(w io.Writer, log *ExecutionLog, n int) error {
+	const (
+		margin = 60
+		colGap = 110
+		rowGap = 80
+	)
+	records := log.sorted()
+	transfers := log.Transfers()
+	x := layout(records, transfers)
+	cols := 0
+	for _, col := range x {
+		if col > cols {
+			cols = col
+		}
+	}
+	posX := func(r Record) int { return margin + x[EventId{r.Pid, r.Index}]*colGap }
+	posY := func(pid int) int { return margin + (pid-1)*rowGap }
+	width := 2*margin + cols*colGap
+	height := 2*margin + (n-1)*rowGap
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n", width, height)
+	fmt.Fprintln(&b, `<defs><marker id="arrow" markerWidth="10" markerHeight="8" refX="10" refY="4" orient="auto"><path d="M0,0 L10,4 L0,8 z" fill="steelblue"/></marker></defs>`)
+	for pid := 1; pid <= n; pid++ {
+		fmt.Fprintf(&b, `<text x="10" y="%d">P%d</text>`+"\n", posY(pid)+4, pid)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", margin-20, posY(pid), width-margin+20, posY(pid))
+	}
+	for _, t := range transfers {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="steelblue" marker-end="url(#arrow)"/>`+"\n",
+			posX(t.Send), posY(t.Send.Pid), posX(t.Recv), posY(t.Recv.Pid))
+	}
+	for _, r := range records {
+		fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="4"/>`+"\n", posX(r), posY(r.Pid))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", posX(r), posY(r.Pid)-10, html.EscapeString(r.Timestamp.String()))
+	}
+	fmt.Fprintln(&b, "</svg>")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exporta a execução como diagrama espaço-tempo no formato DOT (Graphviz).
+// Eventos com a mesma coluna do layout ficam alinhados verticalmente
+func writeDOT(w io.Writer, log *ExecutionLog, n int) error {
+	records := log.sorted()
+	transfers := log.Transfers()
+	x := layout(records, transfers)
+	name := func(r Record) string { return fmt.Sprintf("P%d_%d", r.Pid, r.Index) }
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "digraph execution {")
+	fmt.Fprintln(&b, "  rankdir=LR;")
+	fmt.Fprintln(&b, "  node [shape=box, fontname=monospace, fontsize=10];")
+	columns := make(map[int][]string)
+	for pid := 1; pid <= n; pid++ {
+		fmt.Fprintf(&b, "  P%d_0 [label=\"P%d\", shape=plaintext];\n", pid, pid)
+		columns[0] = append(columns[0], fmt.Sprintf("P%d_0", pid))
+	}
+	for _, r := range records {
+		fmt.Fprintf(&b, "  %s [label=%q];\n", name(r), fmt.Sprintf("%s\n%v", r.Kind, r.Timestamp))
+		fmt.Fprintf(&b, "  P%d_%d -> %s [arrowhead=none, weight=10];\n", r.Pid, r.Index-1, name(r))
+		col := x[EventId{r.Pid, r.Index}]
+		columns[col] = append(columns[col], name(r))
+	}
+	for _, t := range transfers {
+		fmt.Fprintf(&b, "  %s -> %s [color=steelblue, constraint=false];\n", name(t.Send), name(t.Recv))
+	}
+	for col := 0; col < len(columns); col++ {
+		fmt.Fprintf(&b, "  { rank=same; %s }\n", strings.Join(columns[col], "; "))
+	}
+	fmt.Fprintln(&b, "}")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// grava o diagrama da execução no arquivo path usando a função de exportação write
+func exportDiagram(path string, log *ExecutionLog, n int, write func(io.Writer, *ExecutionLog, int) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, log, n); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// responde às perguntas sobre cortes consistentes e predicados globais da execução
+func analyze(log *ExecutionLog, n int, cutText, predicate string, lattice bool) error {
+	a, err := newAnalyzer(log, n)
+	if err != nil {
+		return err
+	}
+	if lattice {
+		fmt.Println("Consistent cuts:")
+		for level, cuts := range a.Lattice() {
+			fmt.Printf("  level %d: %v\n", level, cuts)
+		}
+	}
+	if cutText != "" {
+		cut, err := parseCut(cutText)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cut %v consistent: %v\n", cut, a.IsConsistent(cut))
+	}
+	if predicate != "" {
+		p, err := parsePredicate(predicate, n)
+		if err != nil {
+			return err
+		}
+		if cut, ok := a.Possibly(p); ok {
+			fmt.Printf("Possibly(%s): true (first at cut %v)\n", predicate, cut)
+		} else {
+			fmt.Printf("Possibly(%s): false\n", predicate)
+		}
+		fmt.Printf("Definitely(%s): %v\n", predicate, a.Definitely(p))
+	}
+	return nil
 }
 
 func main() {
-	oneTwo := make(chan Message, 100)
-	twoOne := make(chan Message, 100)
-	twoThree := make(chan Message, 100)
-	threeTwo := make(chan Message, 100)
+	causal := flag.Bool("causal", false, "run the causal broadcast (Birman-Schiper-Stephenson) demo")
+	procs := flag.Int("n", 3, "number of processes in the causal broadcast demo")
+	rounds := flag.Int("rounds", 2, "broadcasts per process in the causal broadcast demo")
+	maxDelay := flag.Duration("delay", 100*time.Millisecond, "maximum random channel delay in the causal broadcast demo")
+	clock := flag.String("clock", "vector", "clock kind: vector, lamport, matrix, hybrid or all (side by side)")
+	flag.DurationVar(&maxSkew, "skew", maxSkew, "maximum simulated physical clock skew between processes (hybrid clocks)")
+	scenarioPath := flag.String("scenario", "", "scenario file (default: the three-process example)")
+	svgPath := flag.String("svg", "", "write the space-time diagram of the run as SVG to this file")
+	dotPath := flag.String("dot", "", "write the space-time diagram of the run as Graphviz DOT to this file")
+	cutText := flag.String("cut", "", "check whether a cut (events per process, e.g. 2,4,1) is consistent")
+	predicate := flag.String("predicate", "", "evaluate Possibly/Definitely for a global predicate, e.g. \"P1.counter > 2 && P3.idle\"")
+	lattice := flag.Bool("lattice", false, "print the lattice of consistent cuts")
+	flag.Parse()
 
-	go processOne(oneTwo, twoOne)
-	go processTwo(oneTwo, twoOne, twoThree, threeTwo)
-	go processThree(twoThree, threeTwo)
+	known := *clock == "all"
+	for _, kind := range clockKinds {
+		known = known || *clock == kind
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "Unknown clock kind: %q (use %s or all)\n", *clock, strings.Join(clockKinds, ", "))
+		os.Exit(1)
+	}
+	if *maxDelay < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid delay: %v (must not be negative)\n", *maxDelay)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if maxSkew < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid skew: %v (must not be negative)\n", maxSkew)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *causal {
+		runCausalBroadcast(*procs, *rounds, *maxDelay)
+		return
+	}
+
+	sc, err := loadScenario(*scenarioPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid scenario: %v\n", err)
+		os.Exit(1)
+	}
+	if err := sc.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid scenario: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *clock == "all" {
+		logs := make(map[string]*ExecutionLog)
+		for _, kind := range clockKinds {
+			fmt.Printf("== %s clocks ==\n", kind)
+			if logs[kind], _, err = runScenario(sc, kind); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		printComparison(logs)
+		return
+	}
+
+	log, snap, err := runScenario(sc, *clock)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	time.Sleep(5 * time.Second)
+	if snap != nil && !checkSnapshot(snap, log) {
+		os.Exit(1)
+	}
+
+	if *clock == "hybrid" && !checkHybridClock(log, maxSkew) {
+		os.Exit(1)
+	}
+
+	// Análise offline dos cortes consistentes da execução
+	if *cutText != "" || *predicate != "" || *lattice {
+		if err := analyze(log, sc.Size(), *cutText, *predicate, *lattice); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Exportação do diagrama espaço-tempo
+	if *svgPath != "" {
+		if err := exportDiagram(*svgPath, log, sc.Size(), writeSVG); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *dotPath != "" {
+		if err := exportDiagram(*dotPath, log, sc.Size(), writeDOT); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Impressao dos pares de eventos concorrentes (apenas relógios vetoriais os distinguem)
+	if *clock == "vector" {
+		fmt.Println("Concurrent events:")
+		for _, pair := range log.ConcurrentPairs() {
+			fmt.Printf("%v || %v\n", pair[0], pair[1])
+		}
+	}
 }
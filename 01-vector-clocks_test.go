@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b VectorClock
+		want Ordering
+	}{
+		{VectorClock{1, 2, 0}, VectorClock{1, 2, 0}, Equal},
+		{VectorClock{0, 0, 0}, VectorClock{0, 0, 0}, Equal},
+		{VectorClock{1, 0, 0}, VectorClock{1, 1, 0}, Before},
+		{VectorClock{1, 2, 0}, VectorClock{2, 3, 1}, Before},
+		{VectorClock{2, 3, 1}, VectorClock{1, 2, 0}, After},
+		{VectorClock{0, 0, 1}, VectorClock{0, 0, 0}, After},
+		{VectorClock{1, 0, 0}, VectorClock{0, 1, 0}, Concurrent},
+		{VectorClock{2, 1, 0}, VectorClock{1, 1, 1}, Concurrent},
+	}
+	for _, c := range cases {
+		if got := Compare(c.a, c.b); got != c.want {
+			t.Errorf("Compare(%v, %v) = %v, esperado %v", c.a, c.b, got, c.want)
+		}
+		if got := HappenedBefore(c.a, c.b); got != (c.want == Before) {
+			t.Errorf("HappenedBefore(%v, %v) = %v", c.a, c.b, got)
+		}
+		if got := IsConcurrent(c.a, c.b); got != (c.want == Concurrent) {
+			t.Errorf("IsConcurrent(%v, %v) = %v", c.a, c.b, got)
+		}
+	}
+}
+
+func TestCanDeliver(t *testing.T) {
+	counter := VectorClock{1, 0, 2}
+	cases := []struct {
+		from int
+		ts   VectorClock
+		want bool
+	}{
+		{2, VectorClock{0, 1, 0}, true},  // próxima mensagem de P2, sem dependências
+		{2, VectorClock{1, 1, 2}, true},  // depende apenas do que já foi entregue
+		{2, VectorClock{0, 2, 0}, false}, // falta a primeira mensagem de P2
+		{2, VectorClock{2, 1, 0}, false}, // depende de uma mensagem de P1 ainda não entregue
+		{1, VectorClock{1, 0, 0}, false}, // mensagem de P1 já entregue
+		{3, VectorClock{1, 0, 3}, true},
+	}
+	for _, c := range cases {
+		m := Message{From: c.from, Timestamp: c.ts}
+		if got := canDeliver(counter, m); got != c.want {
+			t.Errorf("canDeliver(%v, P%d %v) = %v, esperado %v", counter, c.from, c.ts, got, c.want)
+		}
+	}
+}
+
+// com atrasos aleatórios as mensagens chegam fora de ordem, mas cada processo
+// deve entregar todas as difusões respeitando a relação happened-before
+func TestCausalBroadcast(t *testing.T) {
+	for trial := 0; trial < 50; trial++ {
+		n, rounds := 2+trial%4, 1+trial%3
+		procs := runCausalBroadcast(n, rounds, time.Duration(trial%5)*time.Millisecond)
+		if !checkCausalOrder(procs) {
+			t.Fatalf("execução %d: ordem causal violada", trial)
+		}
+		for _, p := range procs {
+			if len(p.Delivered) != n*rounds || len(p.Pending) != 0 {
+				t.Errorf("execução %d: P%d entregou %d de %d mensagens, %d pendentes", trial, p.Pid, len(p.Delivered), n*rounds, len(p.Pending))
+			}
+		}
+	}
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	cases := []struct {
+		text, err string
+	}{
+		{"P1 event", "line 1: missing ':'"},
+		{"X1: event", `line 1: invalid process "X1"`},
+		{"P0: event", `line 1: invalid process "P0"`},
+		{"\n# comentário\nP1: jump P2", `line 3: unknown operation "jump"`},
+		{"P1: event P2", "takes no arguments"},
+		{"P1: send", "needs exactly one process"},
+		{"P1: send P2 P3", "needs exactly one process"},
+		{"P1: recv P1", "P1 cannot talk to itself"},
+		{"# só comentários\n\n", "empty scenario"},
+	}
+	for _, c := range cases {
+		_, err := parseScenario(strings.NewReader(c.text))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("parseScenario(%q): erro %v, esperado %q", c.text, err, c.err)
+		}
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	sc, err := parseScenario(strings.NewReader("P1: event; send P3\np3: receive P1\nP1: snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]Step{
+		{{OpEvent, 0}, {OpSend, 3}, {OpSnapshot, 0}},
+		nil,
+		{{OpRecv, 1}},
+	}
+	if fmt.Sprint(sc.Scripts) != fmt.Sprint(want) {
+		t.Errorf("passos %v, esperados %v", sc.Scripts, want)
+	}
+	if !sc.HasSnapshot() {
+		t.Error("o cenário inicia um snapshot")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		text, err string
+	}{
+		{defaultScenario, ""},
+		{"P1: send P2; send P2\nP2: recv P1", ""},
+		{"P1: recv P2\nP2: event", "P1 receives 1 message(s) from P2, which sends only 0"},
+		{"P1: send P2\nP2: recv P1; recv P1", "P2 receives 2 message(s) from P1, which sends only 1"},
+	}
+	for _, c := range cases {
+		sc, err := parseScenario(strings.NewReader(c.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sc.validate()
+		if (c.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("validate(%q): erro %v, esperado %q", c.text, err, c.err)
+		}
+	}
+}
+
+// cenários em que todo recebimento tem envio, mas a ordem dos passos impede a
+// execução de terminar; validate não os rejeita e o Tracker precisa abortar
+func TestTrackerDeadlock(t *testing.T) {
+	cases := []struct {
+		text     string
+		finished []int
+		blocked  map[int]Wait
+	}{
+		{"P1: recv P2; send P2\nP2: recv P1; send P1", nil, map[int]Wait{1: {0, Link{2, 1}}, 2: {0, Link{1, 2}}}},
+		{"P1: event; send P3\nP2: recv P3; send P3\nP3: recv P1; recv P2; send P2", []int{1}, map[int]Wait{2: {0, Link{3, 2}}, 3: {1, Link{2, 3}}}},
+	}
+	for _, c := range cases {
+		sc, err := parseScenario(strings.NewReader(c.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sc.validate(); err != nil {
+			t.Fatalf("%q: %v", c.text, err)
+		}
+		for _, kind := range clockKinds {
+			_, _, err := runScenario(sc, kind)
+			deadlock, ok := err.(*DeadlockError)
+			if !ok {
+				t.Fatalf("%q com relógio %s: erro %v, esperado *DeadlockError", c.text, kind, err)
+			}
+			if pids(deadlock.Finished) != pids(c.finished) || fmt.Sprint(deadlock.Blocked) != fmt.Sprint(c.blocked) {
+				t.Errorf("%q: terminaram %s e bloquearam %v, esperados %s e %v", c.text, pids(deadlock.Finished), deadlock.Blocked, pids(c.finished), c.blocked)
+			}
+		}
+	}
+}
+
+func TestTrackerFinishes(t *testing.T) {
+	sc, err := loadScenario("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range clockKinds {
+		log, _, err := runScenario(sc, kind)
+		if err != nil {
+			t.Fatalf("relógio %s: %v", kind, err)
+		}
+		if len(log.Records) != 11 {
+			t.Errorf("relógio %s: %d eventos, esperados 11", kind, len(log.Records))
+		}
+	}
+}
+
+// processos com relógios físicos falsos, adiantados de 0 a skew em relação a um
+// tempo comum que só avança. Depois de cada evento L não pode ficar atrás do
+// relógio físico nem adiantar-se mais que skew, e (L, C) cresce em cada
+// processo e do envio para o recebimento
+func TestHybridClockDrift(t *testing.T) {
+	const n, skew = 4, 50
+	for trial := 0; trial < 200; trial++ {
+		now := int64(0)
+		clocks := make([]*HybridClock, n)
+		for i := range clocks {
+			offset := rand.Int63n(skew + 1)
+			clocks[i] = NewHybridClock(func() int64 { return now + offset })
+		}
+		type message struct {
+			to int
+			ts *HybridClock
+		}
+		var inFlight []message
+		for step := 0; step < 100; step++ {
+			// o tempo às vezes fica parado, para que eventos repitam L e usem C
+			now += rand.Int63n(3)
+			pid := 1 + rand.Intn(n)
+			hc := clocks[pid-1]
+			before := hc.Copy().(*HybridClock)
+			switch op := rand.Intn(3); {
+			case op == 0 && len(inFlight) > 0:
+				k := rand.Intn(len(inFlight))
+				m := inFlight[k]
+				inFlight = append(inFlight[:k], inFlight[k+1:]...)
+				hc = clocks[m.to-1]
+				before = hc.Copy().(*HybridClock)
+				hc.Receive(m.to, m.ts)
+				if !m.ts.Less(hc) {
+					t.Fatalf("recebimento %v não é maior que o envio %v", hc, m.ts)
+				}
+			case op == 1:
+				to := 1 + rand.Intn(n)
+				if to == pid {
+					to = 1 + to%n
+				}
+				inFlight = append(inFlight, message{to, hc.Send(pid).(*HybridClock)})
+			default:
+				hc.Tick(pid)
+			}
+			if d := hc.L - hc.PT; d < 0 || d > skew {
+				t.Fatalf("l=%d pt=%d: defasagem %d fora de [0, %d]", hc.L, hc.PT, d, skew)
+			}
+			if !before.Less(hc) {
+				t.Fatalf("(L, C) não cresceu: %v depois de %v", hc, before)
+			}
+		}
+	}
+}
+
+// os processos do cenário rodam em paralelo com os relógios simulados de newClock
+func TestHybridScenario(t *testing.T) {
+	sc, err := parseScenario(strings.NewReader("P1: event; send P2; send P3; recv P3\nP2: recv P1; event; send P3\nP3: recv P1; recv P2; send P1; event"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for trial := 0; trial < 20; trial++ {
+		log, _, err := runScenario(sc, "hybrid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !checkHybridClock(log, maxSkew) {
+			t.Fatalf("execução %d violou as propriedades do HLC", trial)
+		}
+	}
+}
+
+// P1: e1 [1 0], envio s [2 0]; P2: f1 [0 1], recebimento r [2 2]. Os cortes
+// (0,2) e (1,2) são inconsistentes porque incluem r sem s
+func TestAnalyzer(t *testing.T) {
+	sc, err := parseScenario(strings.NewReader("P1: event; send P2\nP2: event; recv P1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, _, err := runScenario(sc, "vector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAnalyzer(log, sc.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lattice := "[[[0 0]] [[1 0] [0 1]] [[2 0] [1 1]] [[2 1]] [[2 2]]]"
+	if got := fmt.Sprint(a.Lattice()); got != lattice {
+		t.Errorf("reticulado %s, esperado %s", got, lattice)
+	}
+	for cut, want := range map[string]bool{
+		"0,0": true, "2,1": true, "2,2": true, "0,2": false, "1,2": false, "3,0": false, "1": false,
+	} {
+		c, _ := parseCut(cut)
+		if got := a.IsConsistent(c); got != want {
+			t.Errorf("IsConsistent(%s) = %v, esperado %v", cut, got, want)
+		}
+	}
+
+	cases := []struct {
+		predicate  string
+		possibly   string
+		definitely bool
+	}{
+		{"P1.counter == 1", "[1 0]", true},
+		{"P1.counter == 1 && P2.counter == 1", "[1 1]", false},
+		{"P2.counter == 2 && !P1.done", "", false},
+		{"P1.counter[2] == 1 || P2.counter == 1", "[0 1]", true},
+		{"P2.done", "[2 2]", true},
+	}
+	for _, c := range cases {
+		p, err := parsePredicate(c.predicate, sc.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cut, ok := a.Possibly(p)
+		if got := fmt.Sprint(cut); ok != (c.possibly != "") || (ok && got != c.possibly) {
+			t.Errorf("Possibly(%s) = %s %v, esperado %q", c.predicate, got, ok, c.possibly)
+		}
+		if got := a.Definitely(p); got != c.definitely {
+			t.Errorf("Definitely(%s) = %v, esperado %v", c.predicate, got, c.definitely)
+		}
+	}
+}
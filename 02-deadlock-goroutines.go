@@ -1,8 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -13,6 +23,10 @@ import (
 * FinishedTime: Representa o tempo quando o processo é visitado pela ultima vez
 * Authorized: Canal que indica quando o processo pode visitar o(s) proximo(s) filho(s)
 * Done: Canal que indica que o(s) filho(s) terminou a execução do algoritmo
+* Clock: Tempo causal da última autorização ou aviso de fim recebido pela busca
+* Probe: Canal que recebe as sondas do algoritmo de Chandy-Misra-Haas
+* Query: Canal que recebe as consultas e respostas da difusão do modelo OR
+* Signal: Canal que recebe as mensagens do algoritmo de Bracha-Toueg
  */
 type Node struct {
 	Value        string
@@ -21,10 +35,101 @@ type Node struct {
 	FinishedTime int
 	Authorized   chan bool
 	Done         chan bool
+	Clock        int
+	Probe        chan Probe
+	Query        chan Query
+	Signal       chan Signal
 }
 
-var count int
-var dList [][]string
+/*
+* Struct que representa a sonda do algoritmo de Chandy-Misra-Haas (modelo AND)
+* Initiator: Processo bloqueado que iniciou a detecção
+* Sender: Processo que enviou a sonda
+* Receiver: Processo que recebe a sonda
+* Time: Tempo causal da sonda (relógio do remetente + 1)
+ */
+type Probe struct {
+	Initiator string
+	Sender    string
+	Receiver  string
+	Time      int
+}
+
+/*
+* Struct que representa a mensagem da difusão de Chandy-Misra-Haas (modelo OR)
+* Initiator: Processo bloqueado que iniciou a difusão
+* Sender: Processo que enviou a mensagem
+* Receiver: Processo que recebe a mensagem
+* Reply: Indica se a mensagem é uma resposta (true) ou uma consulta (false)
+* Time: Tempo causal da mensagem (relógio do remetente + 1)
+ */
+type Query struct {
+	Initiator string
+	Sender    string
+	Receiver  string
+	Reply     bool
+	Time      int
+}
+
+// Tipos de mensagem do algoritmo de Bracha-Toueg
+const (
+	Notify = "NOTIFY" // pede que o processo se junte à detecção
+	Done   = "DONE"   // a notificação enviada terminou
+	Grant  = "GRANT"  // o processo foi liberado e concede o pedido
+	Ack    = "ACK"    // a concessão recebida terminou
+)
+
+/*
+* Struct que representa a mensagem do algoritmo de Bracha-Toueg
+* Kind: NOTIFY, DONE, GRANT ou ACK
+* Sender: Processo que enviou a mensagem
+* Receiver: Processo que recebe a mensagem
+* Time: Tempo causal da mensagem (relógio do remetente + 1)
+ */
+type Signal struct {
+	Kind     string
+	Sender   string
+	Receiver string
+	Time     int
+}
+
+/*
+* Struct que representa o detector de deadlocks de um grafo de espera.
+* Cada detector tem seu próprio relógio e sua lista de ciclos, então vários
+* grafos podem ser analisados ao mesmo tempo
+* Name: Identifica o grafo nas mensagens impressas
+* Quiet: Não imprime o rastro da busca
+* run: Serializa as chamadas de Run no mesmo detector
+* mu: Protege o relógio, a lista de ciclos e os tempos/pais dos nós
+* count: Relógio da busca em profundidade
+* dList: Caminhos onde ocorreu deadlock (um por aresta de retorno)
+* cycles: Todos os ciclos elementares do grafo analisado
+* edges: Arestas classificadas durante a busca, na ordem em que foram percorridas
+* Stats: Autorizações e avisos de fim trocados pela busca
+* graph, nodes: Último grafo analisado e seus processos, com os tempos e pais da busca
+ */
+type Detector struct {
+	Name   string
+	Quiet  bool
+	run    sync.Mutex
+	mu     sync.Mutex
+	count  int
+	dList  [][]string
+	cycles [][]string
+	edges  []Edge
+	Stats  *Stats
+	graph  *Graph
+	nodes  map[string]*Node
+}
+
+// cria um novo detector
+func newDetector(name string) *Detector {
+	return &Detector{
+		Name:  name,
+		dList: make([][]string, 0),
+		Stats: newStats(),
+	}
+}
 
 // cria um novo processo
 func newNode(value string) *Node {
@@ -32,21 +137,43 @@ func newNode(value string) *Node {
 		Value:      value,
 		Authorized: make(chan bool),
 		Done:       make(chan bool),
+		Probe:      make(chan Probe),
+		Query:      make(chan Query),
+		Signal:     make(chan Signal),
+	}
+}
+
+// imprime uma mensagem, identificando o grafo quando ele tem nome
+func logf(name string, format string, args ...interface{}) {
+	if name != "" {
+		format = "[" + name + "] " + format
+	}
+	fmt.Printf(format, args...)
+}
+
+func (d *Detector) logf(format string, args ...interface{}) {
+	if !d.Quiet {
+		logf(d.Name, format, args...)
 	}
 }
 
-// incrementa os tempos dos processos
-func incrementTime(node *Node) {
-	count = count + 1
+// incrementa os tempos dos processos (chamada com d.mu travado)
+func (d *Detector) incrementTime(node *Node) {
+	d.count = d.count + 1
 	if node.VisitedTime == 0 {
-		node.VisitedTime = count
+		node.VisitedTime = d.count
 	} else {
-		node.FinishedTime = count
+		node.FinishedTime = d.count
 	}
 }
 
-// armazena o(s) caminho(s) onde teve ocorrencia de deadlock
-func getDeadlockPath(neigh, currentNode *Node) {
+// armazena o(s) caminho(s) onde teve ocorrencia de deadlock (chamada com d.mu travado)
+func (d *Detector) getDeadlockPath(neigh, currentNode *Node) {
+	if neigh == currentNode {
+		// o processo espera por ele mesmo
+		d.dList = append(d.dList, []string{neigh.Value})
+		return
+	}
 	dSlice := make([]string, 0)
 	// adiciona os nós que se encontram nos extremos da aresta de retorno
 	dSlice = append(dSlice, neigh.Value, currentNode.Value)
@@ -56,129 +183,1953 @@ func getDeadlockPath(neigh, currentNode *Node) {
 		dSlice = append(dSlice, nextNode.Value)
 		nextNode = nextNode.From
 	}
-	dList = append(dList, dSlice)
+	d.dList = append(d.dList, dSlice)
+}
+
+// devolve os deadlocks encontrados
+func (d *Detector) Deadlocks() [][]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]string(nil), d.dList...)
+}
+
+// devolve todos os ciclos elementares do último grafo analisado
+func (d *Detector) Cycles() [][]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]string(nil), d.cycles...)
+}
+
+// autoriza o vizinho a continuar a busca, registrando o processo atual como seu pai.
+// O canal não leva dados, então o tempo da mensagem é passado direto ao vizinho
+func (d *Detector) authorize(currentNode, neigh *Node) {
+	d.mu.Lock()
+	neigh.From = currentNode
+	neigh.Clock = currentNode.Clock + 1
+	d.Stats.send(currentNode.Value, neigh.Value, "authorize", neigh.Clock)
+	d.logf("(Enviando) %s[%d/%d] -> %s[%d/%d]\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, neigh.Value, neigh.VisitedTime, neigh.FinishedTime)
+	d.mu.Unlock()
+	neigh.Authorized <- true
 }
 
-func process(w *sync.WaitGroup, currentNode *Node, beginner bool, neighs ...*Node) {
+// cada processo espera ser autorizado; quem é autorizado sem pai é a raiz de
+// uma busca e avisa em finished quando ela termina
+func (d *Detector) process(w *sync.WaitGroup, finished chan bool, g *Graph, nodes map[string]*Node, currentNode *Node) {
 
 	defer w.Done()
 
-	for _, neigh := range neighs {
-		if neigh.From == nil {
-			neigh.From = currentNode
-		}
+	<-currentNode.Authorized
+	d.mu.Lock()
+	beginner := currentNode.From == nil
+	if !beginner {
+		d.Stats.receive(currentNode.Value)
 	}
-
+	d.incrementTime(currentNode) // Incrementa o VisitedTime
 	if beginner {
 		// Processo iniciador
-		fmt.Printf("* %s é raiz.\n", currentNode.Value)
-		size := len(neighs)
-		incrementTime(currentNode) // Incrementa o VisitedTime
+		d.logf("* %s é raiz.\n", currentNode.Value)
+	} else {
+		// Processo não iniciador
+		d.logf("(Recebendo) %s[%d/%d] -> %s[%d/%d]\n", currentNode.From.Value, currentNode.From.VisitedTime, currentNode.From.FinishedTime, currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime)
+	}
+	d.mu.Unlock()
 
-		fmt.Printf("(Enviando) %s[%d/%d] -> %s[%d/%d]\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, neighs[0].Value, neighs[0].VisitedTime, neighs[0].FinishedTime)
-		neighs[0].Authorized <- true
+	// as esperas são lidas quando o processo é visitado, pois o grafo pode mudar
+	for _, neigh := range nodesNamed(nodes, g.waits(currentNode.Value)) {
+
+		// classifica a aresta pelos tempos: o vizinho ainda não visitado é
+		// filho (árvore); se visitado e não finalizado, é ancestral (retorno);
+		// se finalizado, é descendente (avanço) quando foi visitado depois do
+		// processo atual, ou está em outro ramo (cruzada)
+		d.mu.Lock()
+		visited := neigh.VisitedTime != 0
+		kind := TreeEdge
+		if visited {
+			d.logf("%s já foi visitado!\n", neigh.Value)
+			switch {
+			case neigh.FinishedTime == 0:
+				kind = BackEdge
+				d.logf("# DEADLOCK - Aresta de retorno entre os nós %s e %s\n", currentNode.Value, neigh.Value)
+				d.getDeadlockPath(neigh, currentNode)
+			case neigh.VisitedTime > currentNode.VisitedTime:
+				kind = ForwardEdge
+			default:
+				kind = CrossEdge
+			}
+		}
+		d.edges = append(d.edges, Edge{currentNode.Value, neigh.Value, kind})
+		d.mu.Unlock()
 
-		for i := 1; i < size; i++ {
-			<-currentNode.Done
-			fmt.Printf("(Enviando) %s[%d/%d] -> %s[%d/%d]\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, neighs[i].Value, neighs[i].VisitedTime, neighs[i].FinishedTime)
-			neighs[i].Authorized <- true
+		if !visited {
+			d.authorize(currentNode, neigh)
+			<-currentNode.Done // Espera o filho acabar a execução
+			d.Stats.receive(currentNode.Value)
 		}
 
-		<-currentNode.Done         // Espera o último filho acabar a execução
-		incrementTime(currentNode) // Incrementa o FinishedTime
-		fmt.Printf("Processo (%s[%d/%d]) finalizado.\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime)
-		fmt.Println("Fim!")
+	}
+
+	d.mu.Lock()
+	d.incrementTime(currentNode) // Incrementa o FinishedTime
+	if beginner {
+		d.logf("Processo (%s[%d/%d]) finalizado.\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime)
+		d.logf("Fim!\n")
+		d.mu.Unlock()
+		finished <- true
 	} else {
-		// Processo não iniciador
-		<-currentNode.Authorized
-		incrementTime(currentNode) // Incrementa o VisitedTime
-		fmt.Printf("(Recebendo) %s[%d/%d] -> %s[%d/%d]\n", currentNode.From.Value, currentNode.From.VisitedTime, currentNode.From.FinishedTime, currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime)
+		d.logf("Processo (%s[%d/%d]) finalizado. Voltando para o pai (%s[%d/%d])...\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, currentNode.From.Value, currentNode.From.VisitedTime, currentNode.From.FinishedTime)
+		father := currentNode.From
+		father.Clock = currentNode.Clock + 1
+		d.Stats.send(currentNode.Value, father.Value, "done", father.Clock)
+		d.mu.Unlock()
+		father.Done <- true // Avisa ao pai que as visitas foram finalizadas
+	}
 
-		for _, neigh := range neighs {
+}
 
-			if neigh.VisitedTime != 0 {
-				fmt.Printf("%s já foi visitado!\n", neigh.Value)
-				if neigh.FinishedTime == 0 {
-					fmt.Printf("# DEADLOCK - Aresta de retorno entre os nós %s e %s\n", currentNode.Value, neigh.Value)
-					getDeadlockPath(neigh, currentNode)
-				}
-			} else {
-				fmt.Printf("(Enviando) %s[%d/%d] -> %s[%d/%d]\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, neigh.Value, neigh.VisitedTime, neigh.FinishedTime)
-				neigh.Authorized <- true
-				<-currentNode.Done
+/*
+* Struct que representa um grafo de espera
+* Names: Nós na ordem em que aparecem
+* Edges: Para cada nó, os nós pelos quais ele espera
+* K: Quantos vizinhos precisam atender o nó (sem valor, todos; 1 no modelo OR)
+* Root: Nó por onde a busca começa
+* mu: Protege as esperas quando o grafo muda enquanto os detectores o leem
+ */
+type Graph struct {
+	Names []string
+	Edges map[string][]string
+	K     map[string]int
+	Root  string
+	mu    sync.RWMutex
+}
+
+func newGraph() *Graph {
+	return &Graph{Edges: make(map[string][]string), K: make(map[string]int)}
+}
+
+// quantos dos pedidos do nó precisam ser atendidos para que ele seja liberado
+func (g *Graph) need(name string) int {
+	if k, ok := g.K[name]; ok {
+		return k
+	}
+	return len(g.Edges[name])
+}
+
+// esperas atuais do nó. Os processos dos detectores leem o grafo por aqui
+// (e por requests e waitedBy), pois ele pode mudar durante a detecção
+func (g *Graph) waits(name string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]string(nil), g.Edges[name]...)
+}
+
+// quantos pedidos do nó ainda precisam ser atendidos
+func (g *Graph) requests(name string) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.need(name)
+}
+
+// nós que esperam pelo nó
+func (g *Graph) waitedBy(name string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	list := make([]string, 0)
+	for _, from := range g.Names {
+		for _, to := range g.Edges[from] {
+			if to == name {
+				list = append(list, from)
 			}
+		}
+	}
+	return list
+}
 
+// nós que precisam de mais de um pedido atendido (modelo AND ou k-de-n)
+func (g *Graph) andWaits() []string {
+	list := make([]string, 0)
+	for _, name := range g.Names {
+		if g.need(name) > 1 {
+			list = append(list, name)
 		}
+	}
+	return list
+}
 
-		incrementTime(currentNode) // Incrementa o FinishedTime
-		fmt.Printf("Processo (%s[%d/%d]) finalizado. Voltando para o pai (%s[%d/%d])...\n", currentNode.Value, currentNode.VisitedTime, currentNode.FinishedTime, currentNode.From.Value, currentNode.From.VisitedTime, currentNode.From.FinishedTime)
-		currentNode.From.Done <- true // Avisa ao pai que as visitas foram finalizadas
+// adiciona o nó ao grafo, se ele ainda não existir
+func (g *Graph) addNode(name string) {
+	if _, ok := g.Edges[name]; !ok {
+		g.Names = append(g.Names, name)
+		g.Edges[name] = make([]string, 0)
 	}
+}
 
+// adiciona a aresta from -> to: from espera por to
+func (g *Graph) addEdge(from, to string) {
+	g.addNode(from)
+	g.addNode(to)
+	g.Edges[from] = append(g.Edges[from], to)
 }
 
-func main() {
+// remove uma aresta from -> to: o pedido de from foi atendido por to
+func (g *Graph) removeEdge(from, to string) {
+	for i, next := range g.Edges[from] {
+		if next == to {
+			g.Edges[from] = append(g.Edges[from][:i:i], g.Edges[from][i+1:]...)
+			return
+		}
+	}
+}
 
-	dList = make([][]string, 0)
+// cópia do grafo que pode ser alterada sem afetar o original
+func (g *Graph) clone() *Graph {
+	c := newGraph()
+	c.Root = g.Root
+	for _, name := range g.Names {
+		c.addNode(name)
+		c.Edges[name] = append(c.Edges[name], g.Edges[name]...)
+		if k, ok := g.K[name]; ok {
+			c.K[name] = k
+		}
+	}
+	return c
+}
 
-	/*p := newNode("P")
-	q := newNode("Q")
-	r := newNode("R")
-	n := newNode("N")
-	s := newNode("S")
-	t := newNode("T")
+// indica se um caminho devolvido por getDeadlockPath é um ciclo do grafo. O
+// caminho vem na ordem inversa das esperas: path[i+1] espera por path[i] e
+// path[0] espera pelo último
+func (g *Graph) hasCycle(path []string) bool {
+	for i, to := range path {
+		from := path[(i+1)%len(path)]
+		waits := false
+		for _, next := range g.Edges[from] {
+			waits = waits || next == to
+		}
+		if !waits {
+			return false
+		}
+	}
+	return true
+}
 
-	var w sync.WaitGroup
+// escreve o grafo no formato lido por parseGraph
+func (g *Graph) format() string {
+	var b strings.Builder
+	for _, name := range g.Names {
+		if k, ok := g.K[name]; ok && k > 1 && k < len(g.Edges[name]) {
+			fmt.Fprintf(&b, "k %s %d\n", name, k)
+		}
+		switch {
+		case len(g.Edges[name]) == 0:
+			fmt.Fprintf(&b, "%s\n", name)
+		case g.need(name) == 1 && len(g.Edges[name]) > 1:
+			fmt.Fprintf(&b, "%s -> %s\n", name, strings.Join(g.Edges[name], " | "))
+		default:
+			fmt.Fprintf(&b, "%s -> %s\n", name, strings.Join(g.Edges[name], " "))
+		}
+	}
+	return b.String()
+}
 
-	w.Add(1)
-	go process(&w, t, false, n) // T
+// raiz da busca: a indicada no arquivo, senão o primeiro nó que ninguém espera, senão o primeiro nó
+func (g *Graph) root() string {
+	if g.Root != "" {
+		return g.Root
+	}
+	waited := make(map[string]bool)
+	for _, name := range g.Names {
+		for _, to := range g.Edges[name] {
+			waited[to] = true
+		}
+	}
+	for _, name := range g.Names {
+		if !waited[name] {
+			return name
+		}
+	}
+	return g.Names[0]
+}
 
-	w.Add(1)
-	go process(&w, q, false, r) // Q
+// nós que nunca serão atendidos: reduz o grafo liberando cada nó que tem pelo
+// menos k vizinhos liberados (os que não esperam por ninguém são liberados de
+// início). O que sobra está em deadlock
+func (g *Graph) deadlocked() []string {
+	free := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, name := range g.Names {
+			if free[name] {
+				continue
+			}
+			granted := 0
+			for _, to := range g.Edges[name] {
+				if free[to] {
+					granted++
+				}
+			}
+			if granted >= g.need(name) {
+				free[name] = true
+				changed = true
+			}
+		}
+	}
+	list := make([]string, 0)
+	for _, name := range g.Names {
+		if !free[name] {
+			list = append(list, name)
+		}
+	}
+	return list
+}
 
-	w.Add(1)
-	go process(&w, r, false) // R
+// Busca dos ciclos elementares (algoritmo de Johnson)
+type cycleSearch struct {
+	adj     [][]int
+	start   int
+	inSCC   []bool
+	blocked []bool
+	b       []map[int]bool
+	stack   []int
+	cycles  [][]int
+}
 
-	w.Add(1)
-	go process(&w, n, false, s) // N
+// nós de índice >= start que alcançam e são alcançados por start (sua componente fortemente conexa)
+func (cs *cycleSearch) component() []bool {
+	n := len(cs.adj)
+	forward := make([]bool, n)
+	backward := make([]bool, n)
+	var visit func(v int, seen []bool, next func(int) []int)
+	visit = func(v int, seen []bool, next func(int) []int) {
+		seen[v] = true
+		for _, w := range next(v) {
+			if w >= cs.start && !seen[w] {
+				visit(w, seen, next)
+			}
+		}
+	}
+	reverse := make([][]int, n)
+	for v, list := range cs.adj {
+		for _, w := range list {
+			reverse[w] = append(reverse[w], v)
+		}
+	}
+	visit(cs.start, forward, func(v int) []int { return cs.adj[v] })
+	visit(cs.start, backward, func(v int) []int { return reverse[v] })
+	for v := range forward {
+		forward[v] = forward[v] && backward[v]
+	}
+	return forward
+}
 
-	w.Add(1)
-	go process(&w, s, false, t) // S
+func (cs *cycleSearch) unblock(u int) {
+	cs.blocked[u] = false
+	for w := range cs.b[u] {
+		delete(cs.b[u], w)
+		if cs.blocked[w] {
+			cs.unblock(w)
+		}
+	}
+}
 
-	w.Add(1)
-	go process(&w, p, true, q, n) // P
+func (cs *cycleSearch) circuit(v int) bool {
+	found := false
+	cs.stack = append(cs.stack, v)
+	cs.blocked[v] = true
+	for _, w := range cs.adj[v] {
+		if !cs.inSCC[w] {
+			continue
+		}
+		if w == cs.start {
+			cs.cycles = append(cs.cycles, append([]int(nil), cs.stack...))
+			found = true
+		} else if !cs.blocked[w] && cs.circuit(w) {
+			found = true
+		}
+	}
+	if found {
+		cs.unblock(v)
+	} else {
+		for _, w := range cs.adj[v] {
+			if cs.inSCC[w] {
+				cs.b[w][v] = true
+			}
+		}
+	}
+	cs.stack = cs.stack[:len(cs.stack)-1]
+	return found
+}
+
+// todos os ciclos elementares do grafo, cada um começando pelo nó que aparece primeiro no grafo
+func (g *Graph) elementaryCycles() [][]string {
+	n := len(g.Names)
+	index := make(map[string]int)
+	for i, name := range g.Names {
+		index[name] = i
+	}
+	cs := &cycleSearch{adj: make([][]int, n)}
+	for i, name := range g.Names {
+		seen := make(map[int]bool)
+		for _, to := range g.Edges[name] {
+			if w := index[to]; !seen[w] {
+				seen[w] = true
+				cs.adj[i] = append(cs.adj[i], w)
+			}
+		}
+	}
+	for cs.start = 0; cs.start < n; cs.start++ {
+		cs.inSCC = cs.component()
+		cs.blocked = make([]bool, n)
+		cs.b = make([]map[int]bool, n)
+		for v := range cs.b {
+			cs.b[v] = make(map[int]bool)
+		}
+		cs.circuit(cs.start)
+	}
+
+	cycles := make([][]string, len(cs.cycles))
+	for i, cycle := range cs.cycles {
+		for _, v := range cycle {
+			cycles[i] = append(cycles[i], g.Names[v])
+		}
+	}
+	return cycles
+}
+
+/*
+* Lê um grafo de espera no formato texto:
+*   root P       (opcional) define a raiz da busca
+*   P -> Q R     P espera por Q e por R (modelo AND)
+*   P -> Q | R   P espera por Q ou por R (modelo OR)
+*   k P 2        P é liberado quando 2 dos seus pedidos forem atendidos
+*   S            declara um nó que não espera por ninguém
+* Linhas vazias e iniciadas por # são ignoradas
+ */
+func parseGraph(r io.Reader) (*Graph, error) {
+	g := newGraph()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch {
+		case fields[0] == "root":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("linha %d: use \"root <nó>\"", line)
+			}
+			g.Root = fields[1]
+			g.addNode(fields[1])
+		case fields[0] == "k":
+			k, err := strconv.Atoi(fields[len(fields)-1])
+			if len(fields) != 3 || err != nil || k < 1 {
+				return nil, fmt.Errorf("linha %d: use \"k <nó> <pedidos>\", com pedidos >= 1", line)
+			}
+			g.addNode(fields[1])
+			g.K[fields[1]] = k
+		case len(fields) == 1:
+			g.addNode(fields[0])
+		case fields[1] == "->":
+			g.addNode(fields[0])
+			targets := fields[2:]
+			if rest := strings.Join(targets, " "); strings.Contains(rest, "|") {
+				targets = make([]string, 0)
+				for _, part := range strings.Split(rest, "|") {
+					alternative := strings.Fields(part)
+					if len(alternative) != 1 {
+						return nil, fmt.Errorf("linha %d: separe todos os nós de uma espera OR com \"|\"", line)
+					}
+					targets = append(targets, alternative[0])
+				}
+				g.K[fields[0]] = 1
+			}
+			for _, to := range targets {
+				g.addEdge(fields[0], to)
+			}
+		default:
+			return nil, fmt.Errorf("linha %d: formato inválido %q", line, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(g.Names) == 0 {
+		return nil, fmt.Errorf("grafo vazio")
+	}
+	for _, name := range g.Names {
+		if g.need(name) > len(g.Edges[name]) {
+			return nil, fmt.Errorf("%s precisa de %d pedidos, mas espera por apenas %d", name, g.need(name), len(g.Edges[name]))
+		}
+	}
+	return g, nil
+}
+
+func loadGraph(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseGraph(f)
+}
 
-	w.Wait()*/
+// cria um processo para cada nó e executa a busca a partir da raiz. Quando a
+// busca termina, o primeiro nó ainda não visitado vira a raiz de uma nova
+// busca, até que todos os nós (de todas as componentes) tenham sido visitados.
+// Execuções no mesmo detector são serializadas e cada uma descarta o resultado
+// da anterior
+func (d *Detector) Run(g *Graph) {
+	d.run.Lock()
+	defer d.run.Unlock()
+	d.mu.Lock()
+	d.count = 0
+	d.dList, d.cycles, d.edges = make([][]string, 0), nil, nil
+	d.Stats = newStats()
+	d.mu.Unlock()
 
-	p := newNode("P")
-	q := newNode("Q")
-	r := newNode("R")
-	s := newNode("S")
+	nodes := newNodes(g)
 
 	var w sync.WaitGroup
+	finished := make(chan bool)
+	for _, name := range g.Names {
+		w.Add(1)
+		go d.process(&w, finished, g, nodes, nodes[name])
+	}
 
-	w.Add(1)
-	go process(&w, s, false) // S
+	g.mu.RLock()
+	roots := append([]string{g.root()}, g.Names...)
+	g.mu.RUnlock()
+	for _, root := range roots {
+		d.mu.Lock()
+		visited := nodes[root].VisitedTime != 0
+		d.mu.Unlock()
+		if visited {
+			continue // já visitado por uma busca anterior
+		}
+		nodes[root].Authorized <- true
+		<-finished
+	}
+	w.Wait()
 
-	w.Add(1)
-	go process(&w, q, false, s) // Q
+	g.mu.RLock()
+	cycles := g.elementaryCycles()
+	g.mu.RUnlock()
+	d.mu.Lock()
+	d.cycles = cycles
+	d.graph, d.nodes = g, nodes
+	d.mu.Unlock()
+}
 
-	w.Add(1)
-	go process(&w, r, false, s) // R
+// Tipos de aresta da busca em profundidade
+const (
+	TreeEdge    = "tree"    // levou a busca a um processo ainda não visitado
+	BackEdge    = "back"    // aponta para um ancestral: forma um ciclo
+	ForwardEdge = "forward" // aponta para um descendente já finalizado
+	CrossEdge   = "cross"   // aponta para um processo de outro ramo ou de outra busca
+)
 
-	w.Add(1)
-	go process(&w, p, true, q, r) // P
+/*
+* Struct que representa uma aresta classificada pela busca em profundidade
+* From: Processo que espera
+* To: Processo pelo qual ele espera
+* Kind: tree, back, forward ou cross
+ */
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
 
-	w.Wait()
+// devolve as arestas percorridas pela última busca, já classificadas
+func (d *Detector) Edges() []Edge {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append(make([]Edge, 0), d.edges...)
+}
+
+// ordem topológica do último grafo analisado (cada processo antes dos que ele
+// espera), pela ordem decrescente de finalização. Só existe sem arestas de retorno
+func (d *Detector) TopologicalOrder() ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.edges {
+		if e.Kind == BackEdge {
+			return nil, false
+		}
+	}
+	order := make([]string, 0, len(d.nodes))
+	if d.graph != nil {
+		order = append(order, d.graph.Names...)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return d.nodes[order[i]].FinishedTime > d.nodes[order[j]].FinishedTime
+	})
+	return order, true
+}
+
+// quantas arestas de cada tipo a última busca encontrou
+func (d *Detector) edgeCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, e := range d.Edges() {
+		counts[e.Kind]++
+	}
+	return counts
+}
 
-	// Impressao dos deadlocks detectados, se existirem
+// Impressao dos deadlocks detectados, se existirem
+func (d *Detector) printDeadlocks() {
+	dList := d.Deadlocks()
 	if len(dList) > 0 {
-		fmt.Println("Lista de deadlocks encontrados:")
+		d.logf("Lista de deadlocks encontrados:\n")
 		for i, element := range dList {
-			fmt.Printf("(%d) %v\n", i+1, element)
+			d.logf("(%d) %v\n", i+1, element)
 		}
 	} else {
-		fmt.Println("O sistema não possui deadlocks.")
+		// sem arestas de retorno o grafo é acíclico e pode ser ordenado
+		counts := d.edgeCounts()
+		order, _ := d.TopologicalOrder()
+		d.logf("O sistema não possui deadlocks.\n")
+		d.logf("Nenhuma aresta de retorno: %d de árvore, %d de avanço e %d cruzadas.\n", counts[TreeEdge], counts[ForwardEdge], counts[CrossEdge])
+		d.logf("Ordem topológica (cada processo antes dos que espera): %v\n", order)
+	}
+
+	if cycles := d.Cycles(); len(cycles) > 0 {
+		d.logf("Ciclos elementares (cada processo espera pelo seguinte):\n")
+		for i, cycle := range cycles {
+			d.logf("(%d) %v\n", i+1, cycle)
+		}
+	}
+}
+
+/*
+* Struct que representa um canal em um sentido: de From para To
+ */
+type Link struct {
+	From string
+	To   string
+}
+
+/*
+* Struct que mede uma execução. Cópia da de 03-tarry.go (não há módulo comum); mantenha as duas iguais
+* Messages: Total de mensagens enviadas
+* ByKind: Mensagens de cada tipo
+* PerLink: Mensagens em cada canal, por sentido
+* Sent, Received: Mensagens enviadas e recebidas por cada processo
+* Depth: Profundidade causal: a maior cadeia de mensagens em que cada uma foi
+* enviada depois de a anterior chegar. É a duração da execução quando cada
+* mensagem leva uma unidade de tempo e o processamento local é instantâneo
+ */
+type Stats struct {
+	Messages int
+	ByKind   map[string]int
+	PerLink  map[Link]int
+	Sent     map[string]int
+	Received map[string]int
+	Depth    int
+	mu       sync.Mutex
+}
+
+func newStats() *Stats {
+	return &Stats{
+		ByKind:   make(map[string]int),
+		PerLink:  make(map[Link]int),
+		Sent:     make(map[string]int),
+		Received: make(map[string]int),
+	}
+}
+
+// registra o envio de uma mensagem do tipo kind de from para to; time é o
+// tamanho da cadeia causal que termina nela
+func (s *Stats) send(from, to, kind string, time int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Messages++
+	s.ByKind[kind]++
+	s.PerLink[Link{from, to}]++
+	s.Sent[from]++
+	if time > s.Depth {
+		s.Depth = time
+	}
+}
+
+// registra que to recebeu uma mensagem
+func (s *Stats) receive(to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Received[to]++
+}
+
+// imprime as medidas; ids define a ordem dos processos
+func (s *Stats) print(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kinds := make([]string, 0, len(s.ByKind))
+	for kind, n := range s.ByKind {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", kind, n))
+	}
+	sort.Strings(kinds)
+	fmt.Printf("Mensagens: %d (%s), profundidade causal: %d\n", s.Messages, strings.Join(kinds, " "), s.Depth)
+
+	links := make([]Link, 0, len(s.PerLink))
+	for link := range s.PerLink {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].From != links[j].From {
+			return links[i].From < links[j].From
+		}
+		return links[i].To < links[j].To
+	})
+	fmt.Println("Mensagens por canal:")
+	for _, link := range links {
+		fmt.Printf("  %s -> %s: %d\n", link.From, link.To, s.PerLink[link])
+	}
+	fmt.Println("Mensagens por processo (enviadas/recebidas):")
+	for _, id := range ids {
+		fmt.Printf("  %s: %d/%d\n", id, s.Sent[id], s.Received[id])
+	}
+}
+
+/*
+* Struct com o que os detectores por troca de mensagens (cmh, or e bt) têm em
+* comum: um processo por nó, mensagens entregues sem bloquear o remetente e a
+* espera até que nenhuma mensagem esteja em trânsito
+* Name: Identifica o grafo nas mensagens impressas
+* Quiet: Não imprime as mensagens trocadas
+* Stats: Medidas das mensagens trocadas
+* Delay: Atraso máximo de cada mensagem (sorteado a cada envio)
+* marked: Processos marcados pelo algoritmo (em deadlock ou liberados)
+* inFlight: Mensagens enviadas e ainda não tratadas
+ */
+type network struct {
+	Name     string
+	Quiet    bool
+	Stats    *Stats
+	Delay    time.Duration
+	mu       sync.Mutex
+	marked   map[string]bool
+	inFlight sync.WaitGroup
+}
+
+func newNetwork(name string) network {
+	return network{Name: name, Stats: newStats(), marked: make(map[string]bool)}
+}
+
+func (n *network) logf(format string, args ...interface{}) {
+	if !n.Quiet {
+		logf(n.Name, format, args...)
+	}
+}
+
+// registra a mensagem do tipo kind de from para to, com tempo causal clock, e
+// a entrega com deliver sem bloquear o remetente
+func (n *network) post(from, to, kind string, clock int, deliver func()) {
+	n.Stats.send(from, to, kind, clock)
+	n.inFlight.Add(1)
+	delay := time.Duration(0)
+	if n.Delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(n.Delay)))
+	}
+	go func() {
+		time.Sleep(delay)
+		deliver()
+	}()
+}
+
+// registra que o destinatário to terminou de tratar uma mensagem
+func (n *network) handled(to string) {
+	n.Stats.receive(to)
+	n.inFlight.Done()
+}
+
+func (n *network) mark(name string) {
+	n.mu.Lock()
+	n.marked[name] = true
+	n.mu.Unlock()
+}
+
+// processos do grafo marcados (ou não marcados, se marked é false), na ordem do grafo
+func (n *network) list(g *Graph, marked bool) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	list := make([]string, 0)
+	for _, name := range g.Names {
+		if n.marked[name] == marked {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// executa process em um goroutine para cada nó do grafo, chama initiate (se
+// houver) quando todos começaram e espera até que nenhuma mensagem esteja em trânsito
+func (n *network) run(g *Graph, nodes map[string]*Node, process func(started *sync.WaitGroup, quit chan struct{}, node *Node), initiate func()) {
+	quit := make(chan struct{})
+	var started, finished sync.WaitGroup
+	for _, name := range g.Names {
+		started.Add(1)
+		finished.Add(1)
+		go func(node *Node) {
+			defer finished.Done()
+			process(&started, quit, node)
+		}(nodes[name])
+	}
+	started.Wait()
+	if initiate != nil {
+		initiate()
+	}
+	n.inFlight.Wait()
+	close(quit)
+	finished.Wait()
+}
+
+// cria um processo para cada nó do grafo
+func newNodes(g *Graph) map[string]*Node {
+	nodes := make(map[string]*Node)
+	for _, name := range g.Names {
+		nodes[name] = newNode(name)
+	}
+	return nodes
+}
+
+// processos com os nomes dados, na mesma ordem
+func nodesNamed(nodes map[string]*Node, names []string) []*Node {
+	list := make([]*Node, 0, len(names))
+	for _, name := range names {
+		list = append(list, nodes[name])
+	}
+	return list
+}
+
+/*
+* Struct que representa o detector distribuído de Chandy-Misra-Haas (modelo AND).
+* Cada processo bloqueado envia sondas pelas suas arestas de espera; quem
+* recebe uma sonda e também está bloqueado a repassa pelas suas arestas. Um
+* processo está em deadlock quando recebe de volta a sonda que iniciou; ele
+* fica marcado na rede
+ */
+type ProbeDetector struct {
+	network
+}
+
+func newProbeDetector(name string) *ProbeDetector {
+	return &ProbeDetector{newNetwork(name)}
+}
+
+// envia a sonda ao processo neigh sem bloquear o remetente
+func (d *ProbeDetector) send(probe Probe, neigh *Node) {
+	d.logf("(Sonda) %s -> %s [iniciador %s]\n", probe.Sender, probe.Receiver, probe.Initiator)
+	d.post(probe.Sender, probe.Receiver, "probe", probe.Time, func() {
+		neigh.Probe <- probe
+	})
+}
+
+func (d *ProbeDetector) process(started *sync.WaitGroup, quit chan struct{}, g *Graph, nodes map[string]*Node, currentNode *Node) {
+
+	forwarded := make(map[string]bool) // iniciadores cujas sondas já foram repassadas
+	clock := 0                         // tempo causal da última mensagem recebida
+
+	// o processo está bloqueado enquanto espera por algum outro; as esperas são
+	// lidas a cada sonda, pois o grafo pode mudar durante a detecção
+	neighs := nodesNamed(nodes, g.waits(currentNode.Value))
+	if len(neighs) > 0 {
+		forwarded[currentNode.Value] = true
+		for _, neigh := range neighs {
+			d.send(Probe{currentNode.Value, currentNode.Value, neigh.Value, clock + 1}, neigh)
+		}
+	}
+	started.Done()
+
+	for {
+		select {
+		case probe := <-currentNode.Probe:
+			clock = max(clock, probe.Time)
+			neighs := nodesNamed(nodes, g.waits(currentNode.Value))
+			if len(neighs) > 0 {
+				if probe.Initiator == currentNode.Value {
+					d.logf("# DEADLOCK - A sonda de %s voltou (enviada por %s)\n", currentNode.Value, probe.Sender)
+					d.mark(currentNode.Value)
+				} else if !forwarded[probe.Initiator] {
+					forwarded[probe.Initiator] = true
+					for _, neigh := range neighs {
+						d.send(Probe{probe.Initiator, currentNode.Value, neigh.Value, clock + 1}, neigh)
+					}
+				}
+			}
+			d.handled(currentNode.Value)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// cria um processo para cada nó do grafo e espera até que nenhuma sonda esteja em trânsito
+func (d *ProbeDetector) Run(g *Graph) {
+	nodes := newNodes(g)
+	d.run(g, nodes, func(started *sync.WaitGroup, quit chan struct{}, node *Node) {
+		d.process(started, quit, g, nodes, node)
+	}, nil)
+}
+
+// processos em deadlock, na ordem do grafo
+func (d *ProbeDetector) Deadlocked(g *Graph) []string {
+	return d.list(g, true)
+}
+
+/*
+* Struct que representa o detector de Chandy-Misra-Haas para o modelo OR.
+* Cada processo bloqueado inicia uma difusão enviando consultas a todos os
+* processos pelos quais espera. A primeira consulta de um iniciador que chega a
+* um processo bloqueado o engaja: ele repassa a consulta aos seus vizinhos e só
+* responde a quem o engajou depois de receber a resposta de todos eles; as
+* consultas seguintes do mesmo iniciador são respondidas imediatamente.
+* Processos ativos não respondem. O iniciador está em deadlock quando recebe a
+* resposta de todos os vizinhos, pois nenhum processo alcançável pode liberá-lo;
+* ele fica marcado na rede. Todo nó do grafo precisa esperar no modelo OR
+* (veja andWaits): um nó AND está bloqueado quando qualquer pedido está, o que a
+* difusão não sabe decidir
+ */
+type QueryDetector struct {
+	network
+}
+
+func newQueryDetector(name string) *QueryDetector {
+	return &QueryDetector{newNetwork(name)}
+}
+
+// envia a consulta ou resposta ao processo to sem bloquear o remetente
+func (d *QueryDetector) send(query Query, to *Node) {
+	kind, label := "query", "Consulta"
+	if query.Reply {
+		kind, label = "reply", "Resposta"
+	}
+	d.logf("(%s) %s -> %s [iniciador %s]\n", label, query.Sender, query.Receiver, query.Initiator)
+	d.post(query.Sender, query.Receiver, kind, query.Time, func() {
+		to.Query <- query
+	})
+}
+
+func (d *QueryDetector) process(started *sync.WaitGroup, quit chan struct{}, g *Graph, nodes map[string]*Node, currentNode *Node) {
+
+	engager := make(map[string]string) // quem engajou o processo em cada difusão
+	pending := make(map[string]int)    // respostas que faltam em cada difusão
+	clock := 0                         // tempo causal da última mensagem recebida
+
+	// as esperas são lidas a cada mensagem, pois o grafo pode mudar durante a detecção
+	neighs := nodesNamed(nodes, g.waits(currentNode.Value))
+	if len(neighs) > 0 {
+		pending[currentNode.Value] = len(neighs)
+		for _, neigh := range neighs {
+			d.send(Query{currentNode.Value, currentNode.Value, neigh.Value, false, clock + 1}, neigh)
+		}
+	}
+	started.Done()
+
+	for {
+		select {
+		case query := <-currentNode.Query:
+			clock = max(clock, query.Time)
+			neighs := nodesNamed(nodes, g.waits(currentNode.Value))
+			if len(neighs) > 0 {
+				_, engaged := pending[query.Initiator]
+				switch {
+				case !query.Reply && !engaged:
+					engager[query.Initiator] = query.Sender
+					pending[query.Initiator] = len(neighs)
+					for _, neigh := range neighs {
+						d.send(Query{query.Initiator, currentNode.Value, neigh.Value, false, clock + 1}, neigh)
+					}
+				case !query.Reply:
+					d.send(Query{query.Initiator, currentNode.Value, query.Sender, true, clock + 1}, nodes[query.Sender])
+				default:
+					pending[query.Initiator]--
+					if pending[query.Initiator] > 0 {
+						break
+					}
+					if query.Initiator == currentNode.Value {
+						d.logf("# DEADLOCK - %s recebeu a resposta de todos os vizinhos\n", currentNode.Value)
+						d.mark(currentNode.Value)
+					} else {
+						up := engager[query.Initiator]
+						d.send(Query{query.Initiator, currentNode.Value, up, true, clock + 1}, nodes[up])
+					}
+				}
+			}
+			d.handled(currentNode.Value)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// cria um processo para cada nó do grafo e espera até que nenhuma mensagem esteja em trânsito
+func (d *QueryDetector) Run(g *Graph) {
+	nodes := newNodes(g)
+	d.run(g, nodes, func(started *sync.WaitGroup, quit chan struct{}, node *Node) {
+		d.process(started, quit, g, nodes, node)
+	}, nil)
+}
+
+// processos em deadlock, na ordem do grafo
+func (d *QueryDetector) Deadlocked(g *Graph) []string {
+	return d.list(g, true)
+}
+
+/*
+* Struct que representa o detector de Bracha-Toueg para o modelo k-de-n, em que
+* cada processo é liberado quando k dos seus n pedidos forem atendidos.
+* A fase de notificação (NOTIFY/DONE) percorre os processos alcançáveis e cada
+* processo sem pedidos pendentes inicia a fase de concessão (GRANT/ACK),
+* simulando a liberação dos que esperam por ele. Quando a notificação termina,
+* todas as concessões possíveis foram feitas: quem não foi liberado está em
+* deadlock. O detector notifica cada processo ainda não notificado, em ordem,
+* para cobrir todas as componentes do grafo. Os processos liberados ficam
+* marcados na rede
+ */
+type NotifyDetector struct {
+	network
+}
+
+func newNotifyDetector(name string) *NotifyDetector {
+	return &NotifyDetector{newNetwork(name)}
+}
+
+// envia a mensagem ao processo to sem bloquear o remetente. O detector, que
+// inicia cada notificação, é o remetente sem nome
+func (d *NotifyDetector) send(kind, from string, time int, to *Node) {
+	sender := from
+	if sender == "" {
+		sender = "detector"
+	}
+	d.logf("(%s) %s -> %s\n", kind, sender, to.Value)
+	d.post(sender, to.Value, kind, time, func() {
+		to.Signal <- Signal{kind, from, to.Value, time}
+	})
+}
+
+/*
+* Cada processo trata as mensagens como uma máquina de estados, pois as esperas
+* por DONE e ACK do algoritmo original acontecem enquanto outras mensagens chegam.
+* As esperas são lidas do grafo quando são usadas, pois ele pode mudar durante a
+* detecção
+* requests: Pedidos que ainda precisam ser atendidos (-1 até a primeira mensagem)
+* notifier: Quem enviou a notificação que o processo está tratando
+* waitDone: DONEs que faltam para terminar a notificação
+* replyTo: Quem enviou a concessão que liberou o processo (vazio se foi a notificação)
+* waitAck: ACKs que faltam para terminar a concessão
+* clock: Tempo causal da última mensagem recebida
+ */
+func (d *NotifyDetector) process(started *sync.WaitGroup, quit chan struct{}, g *Graph, nodes map[string]*Node, currentNode *Node) {
+
+	requests := -1
+	notified, notifying, granting, free := false, false, false, false
+	notifier, replyTo := "", ""
+	waitDone, waitAck, clock := 0, 0, 0
+
+	finishNotify := func() {
+		if notifying && waitDone == 0 && !granting {
+			notifying = false
+			d.send(Done, currentNode.Value, clock+1, nodes[notifier])
+		}
+	}
+	finishGrant := func() {
+		if granting && waitAck == 0 {
+			granting = false
+			if replyTo != "" {
+				d.send(Ack, currentNode.Value, clock+1, nodes[replyTo])
+			}
+			finishNotify()
+		}
+	}
+	grant := func(from string) {
+		free = true
+		d.logf("* %s foi liberado.\n", currentNode.Value)
+		d.mark(currentNode.Value)
+		in := nodesNamed(nodes, g.waitedBy(currentNode.Value))
+		granting, replyTo, waitAck = true, from, len(in)
+		for _, neigh := range in {
+			d.send(Grant, currentNode.Value, clock+1, neigh)
+		}
+		finishGrant()
+	}
+	started.Done()
+
+	for {
+		select {
+		case signal := <-currentNode.Signal:
+			clock = max(clock, signal.Time)
+			if requests < 0 {
+				requests = g.requests(currentNode.Value)
+			}
+			switch signal.Kind {
+			case Notify:
+				if notified {
+					d.send(Done, currentNode.Value, clock+1, nodes[signal.Sender])
+					break
+				}
+				out := nodesNamed(nodes, g.waits(currentNode.Value))
+				notified, notifying, notifier, waitDone = true, true, signal.Sender, len(out)
+				for _, neigh := range out {
+					d.send(Notify, currentNode.Value, clock+1, neigh)
+				}
+				// uma concessão pode ter liberado o processo antes da notificação
+				if requests == 0 && !free {
+					grant("")
+				}
+				finishNotify()
+			case Done:
+				waitDone--
+				finishNotify()
+			case Grant:
+				if requests > 0 {
+					requests--
+					if requests == 0 {
+						grant(signal.Sender)
+						break
+					}
+				}
+				d.send(Ack, currentNode.Value, clock+1, nodes[signal.Sender])
+			case Ack:
+				waitAck--
+				finishGrant()
+			}
+			d.handled(currentNode.Value)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// cria um processo para cada nó do grafo e notifica, um a um, os que ainda não
+// foram notificados, esperando o DONE de cada notificação
+func (d *NotifyDetector) Run(g *Graph) {
+	nodes := newNodes(g)
+	initiator := newNode("detector")
+	nodes[""] = initiator
+
+	d.run(g, nodes, func(started *sync.WaitGroup, quit chan struct{}, node *Node) {
+		d.process(started, quit, g, nodes, node)
+	}, func() {
+		for _, name := range g.Names {
+			d.send(Notify, "", 1, nodes[name])
+			<-initiator.Signal
+			d.handled(initiator.Value)
+		}
+	})
+}
+
+// processos que não foram liberados, na ordem do grafo
+func (d *NotifyDetector) Deadlocked(g *Graph) []string {
+	return d.list(g, false)
+}
+
+// processos que aparecem em algum dos ciclos, na ordem do grafo
+func nodesIn(g *Graph, cycles [][]string) []string {
+	in := make(map[string]bool)
+	for _, cycle := range cycles {
+		for _, name := range cycle {
+			in[name] = true
+		}
+	}
+	list := make([]string, 0)
+	for _, name := range g.Names {
+		if in[name] {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+/*
+* Struct que reúne o resultado dos detectores executados sobre um grafo
+* DFS: Busca em profundidade com relógio global
+* Probe: Perseguição de arestas de Chandy-Misra-Haas
+* Query: Difusão de consultas de Chandy-Misra-Haas (modelo OR)
+* Notify: Notificações e concessões de Bracha-Toueg (modelo k-de-n)
+ */
+type Analysis struct {
+	Name   string
+	Graph  *Graph
+	DFS    *Detector
+	Probe  *ProbeDetector
+	Query  *QueryDetector
+	Notify *NotifyDetector
+}
+
+// executa sobre o grafo cada algoritmo pedido (dfs, cmh, or, bt); delay é o
+// atraso máximo das mensagens de cmh, or e bt
+func analyze(name string, g *Graph, algorithms []string, quiet bool, delay time.Duration) *Analysis {
+	a := &Analysis{Name: name, Graph: g}
+	for _, alg := range algorithms {
+		switch alg {
+		case "dfs":
+			a.DFS = newDetector(name)
+			a.DFS.Quiet = quiet
+			a.DFS.Run(g)
+		case "cmh":
+			a.Probe = newProbeDetector(name)
+			a.Probe.Quiet = quiet
+			a.Probe.Delay = delay
+			a.Probe.Run(g)
+		case "or":
+			a.Query = newQueryDetector(name)
+			a.Query.Quiet = quiet
+			a.Query.Delay = delay
+			a.Query.Run(g)
+		case "bt":
+			a.Notify = newNotifyDetector(name)
+			a.Notify.Quiet = quiet
+			a.Notify.Delay = delay
+			a.Notify.Run(g)
+		}
+	}
+	return a
+}
+
+/*
+* Struct que representa os processos em deadlock apontados por um algoritmo
+* Alg: Nome do algoritmo (dfs, cmh, or, bt)
+* Label: Nome do algoritmo com o número de mensagens trocadas, para exibição
+* Messages: Número de mensagens trocadas
+* Nodes: Processos em deadlock, na ordem do grafo
+ */
+type Result struct {
+	Alg      string   `json:"alg"`
+	Label    string   `json:"label"`
+	Messages int      `json:"messages"`
+	Nodes    []string `json:"deadlocked"`
+}
+
+// resultado de cada algoritmo executado. Na busca em profundidade, cada aresta
+// de árvore leva uma autorização e traz de volta um aviso de término
+func (a *Analysis) results() []Result {
+	list := make([]Result, 0)
+	if a.DFS != nil {
+		list = append(list, Result{"dfs", fmt.Sprintf("dfs (%d mensagens)", a.DFS.Stats.Messages), a.DFS.Stats.Messages, nodesIn(a.Graph, a.DFS.Deadlocks())})
+	}
+	if a.Probe != nil {
+		list = append(list, Result{"cmh", fmt.Sprintf("cmh (%d sondas)", a.Probe.Stats.Messages), a.Probe.Stats.Messages, a.Probe.Deadlocked(a.Graph)})
+	}
+	if a.Query != nil {
+		list = append(list, Result{"or", fmt.Sprintf("or (%d mensagens)", a.Query.Stats.Messages), a.Query.Stats.Messages, a.Query.Deadlocked(a.Graph)})
+	}
+	if a.Notify != nil {
+		list = append(list, Result{"bt", fmt.Sprintf("bt (%d mensagens)", a.Notify.Stats.Messages), a.Notify.Stats.Messages, a.Notify.Deadlocked(a.Graph)})
+	}
+	return list
+}
+
+/*
+* Struct que representa um processo no relatório da busca em profundidade
+* Name: Identifica o processo
+* Visited, Finished: Tempos de visita e de finalização
+* Parent: Processo que o visitou (vazio nas raízes)
+ */
+type NodeReport struct {
+	Name     string `json:"name"`
+	Visited  int    `json:"visited"`
+	Finished int    `json:"finished"`
+	Parent   string `json:"parent,omitempty"`
+}
+
+/*
+* Struct que representa o relatório da análise de um grafo
+* Graph: Nome do grafo (arquivo de origem)
+* Nodes, Edges, Deadlocks, Cycles: Resultado da busca em profundidade (null se ela não foi executada)
+* Topological: Ordem topológica dada pela busca (null se há ciclos)
+* Deadlocked: Processos que sobram na redução do grafo
+* Algorithms: Processos em deadlock apontados por cada algoritmo
+ */
+type Report struct {
+	Graph       string       `json:"graph"`
+	Nodes       []NodeReport `json:"nodes"`
+	Edges       []Edge       `json:"edges"`
+	Deadlocks   [][]string   `json:"deadlocks"`
+	Cycles      [][]string   `json:"cycles"`
+	Topological []string     `json:"topological"`
+	Deadlocked  []string     `json:"deadlocked"`
+	Algorithms  []Result     `json:"algorithms"`
+}
+
+// monta o relatório da análise
+func (a *Analysis) report(name string) Report {
+	r := Report{Graph: name, Deadlocked: a.Graph.deadlocked(), Algorithms: a.results()}
+	if a.DFS == nil {
+		return r
+	}
+	a.DFS.mu.Lock()
+	for _, n := range a.Graph.Names {
+		node := a.DFS.nodes[n]
+		nr := NodeReport{Name: n, Visited: node.VisitedTime, Finished: node.FinishedTime}
+		if node.From != nil {
+			nr.Parent = node.From.Value
+		}
+		r.Nodes = append(r.Nodes, nr)
+	}
+	a.DFS.mu.Unlock()
+	r.Edges = a.DFS.Edges()
+	r.Topological, _ = a.DFS.TopologicalOrder()
+	r.Deadlocks = append(make([][]string, 0), a.DFS.Deadlocks()...)
+	r.Cycles = append(make([][]string, 0), a.DFS.Cycles()...)
+	return r
+}
+
+// grava os relatórios em JSON no arquivo path ("-" para a saída padrão)
+func writeReports(path string, reports []Report) error {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// imprime o resultado de cada algoritmo e, se mais de um foi executado, compara
+// os processos em deadlock com os que sobram na redução do grafo
+func (a *Analysis) print() {
+	if a.DFS != nil {
+		a.DFS.printDeadlocks()
+	}
+	results := a.results()
+	if len(results) == 1 && a.DFS != nil {
+		return
+	}
+	expected := a.Graph.deadlocked()
+	dead := make(map[string]bool)
+	for _, name := range expected {
+		dead[name] = true
+	}
+	logf(a.Name, "Processos em deadlock por algoritmo:\n")
+	logf(a.Name, "  redução do grafo: %v\n", expected)
+	for _, r := range results {
+		wrong := make([]string, 0)
+		for _, name := range r.Nodes {
+			if !dead[name] {
+				wrong = append(wrong, name)
+			}
+		}
+		if len(wrong) > 0 {
+			logf(a.Name, "  %s: %v ! falsos deadlocks %v\n", r.Label, r.Nodes, wrong)
+		} else {
+			logf(a.Name, "  %s: %v\n", r.Label, r.Nodes)
+		}
+	}
+}
+
+// imprime as medidas das mensagens de cada detector por troca de mensagens
+func (a *Analysis) printStats() {
+	if a.DFS != nil {
+		logf(a.Name, "Mensagens de dfs:\n")
+		a.DFS.Stats.print(a.Graph.Names)
+	}
+	if a.Probe != nil {
+		logf(a.Name, "Mensagens de cmh:\n")
+		a.Probe.Stats.print(a.Graph.Names)
+	}
+	if a.Query != nil {
+		logf(a.Name, "Mensagens de or:\n")
+		a.Query.Stats.print(a.Graph.Names)
+	}
+	if a.Notify != nil {
+		logf(a.Name, "Mensagens de bt:\n")
+		a.Notify.Stats.print(a.Graph.Names)
+	}
+}
+
+/*
+* Struct que representa uma transação que adquire e libera travas
+* Name: Identifica a transação. Ex: T1, T2,...
+* Start: Ordem em que a transação começou (maior é mais jovem); é mantida quando ela reinicia
+* Priority: Prioridade da transação
+* Locks: Recursos travados pela transação
+* Waiting: Recurso pelo qual a transação espera, se estiver bloqueada
+* aborted: Indica que a transação foi escolhida como vítima
+ */
+type Transaction struct {
+	Name     string
+	Start    int
+	Priority int
+	Locks    []string
+	Waiting  string
+	aborted  bool
+}
+
+// escolhe a transação do ciclo que será abortada
+type Policy func(cycle []*Transaction) *Transaction
+
+// escolhe a transação com o menor valor de key; empates ficam com a mais jovem
+func victimBy(key func(t *Transaction) int) Policy {
+	return func(cycle []*Transaction) *Transaction {
+		victim := cycle[0]
+		for _, t := range cycle[1:] {
+			if key(t) < key(victim) || (key(t) == key(victim) && t.Start > victim.Start) {
+				victim = t
+			}
+		}
+		return victim
+	}
+}
+
+// políticas de escolha da vítima
+var policies = map[string]Policy{
+	"youngest": victimBy(func(t *Transaction) int { return -t.Start }),
+	"fewest":   victimBy(func(t *Transaction) int { return len(t.Locks) }),
+	"priority": victimBy(func(t *Transaction) int { return t.Priority }),
+}
+
+/*
+* Struct que representa o gerenciador de travas. O grafo de espera muda a cada
+* trava adquirida ou liberada: a transação bloqueada espera por quem detém o
+* recurso que ela pediu
+* mu: Protege as travas e o estado das transações
+* cond: Acorda as transações bloqueadas quando alguma trava é liberada
+* Holder: Transação que detém cada recurso
+* Txns: Transações, na ordem em que foram criadas
+* Commits, Aborts, Deadlocks: Contadores da simulação
+ */
+type LockManager struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	Holder    map[string]*Transaction
+	Txns      []*Transaction
+	Commits   int
+	Aborts    int
+	Deadlocks int
+}
+
+func newLockManager(n int) *LockManager {
+	m := &LockManager{Holder: make(map[string]*Transaction)}
+	m.cond = sync.NewCond(&m.mu)
+	for i := 1; i <= n; i++ {
+		m.Txns = append(m.Txns, &Transaction{Name: fmt.Sprintf("T%d", i), Start: i, Priority: rand.Intn(10)})
+	}
+	return m
+}
+
+// bloqueia até que a transação t obtenha o recurso r; devolve false se ela foi abortada
+func (m *LockManager) acquire(t *Transaction, r string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.Holder[r] != nil && m.Holder[r] != t && !t.aborted {
+		if t.Waiting == "" {
+			fmt.Printf("%s espera por %s (com %s)\n", t.Name, r, m.Holder[r].Name)
+		}
+		t.Waiting = r
+		m.cond.Wait()
+	}
+	t.Waiting = ""
+	if t.aborted {
+		return false
+	}
+	if m.Holder[r] != t {
+		m.Holder[r] = t
+		t.Locks = append(t.Locks, r)
+		fmt.Printf("%s adquiriu %s\n", t.Name, r)
+	}
+	return true
+}
+
+// libera todas as travas da transação t (chamada com m.mu travado)
+func (m *LockManager) releaseAll(t *Transaction) {
+	for _, r := range t.Locks {
+		delete(m.Holder, r)
+	}
+	t.Locks = nil
+	m.cond.Broadcast()
+}
+
+// confirma a transação t, liberando suas travas
+func (m *LockManager) commit(t *Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Printf("%s confirmou e liberou %v\n", t.Name, t.Locks)
+	m.releaseAll(t)
+	m.Commits++
+}
+
+// grafo de espera atual (chamada com m.mu travado)
+func (m *LockManager) graph() *Graph {
+	g := newGraph()
+	for _, t := range m.Txns {
+		g.addNode(t.Name)
+		if h := m.Holder[t.Waiting]; t.Waiting != "" && h != nil && h != t {
+			g.addEdge(t.Name, h.Name)
+		}
+	}
+	return g
+}
+
+// executa a transação t rounds vezes, travando want recursos escolhidos ao acaso.
+// Se ela for abortada, espera um pouco e recomeça
+func (m *LockManager) run(t *Transaction, resources []string, want, rounds int) {
+	for done := 0; done < rounds; {
+		m.mu.Lock()
+		t.aborted = false
+		m.mu.Unlock()
+
+		ok := true
+		for _, i := range rand.Perm(len(resources))[:want] {
+			if !m.acquire(t, resources[i]) {
+				ok = false
+				break
+			}
+			time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		}
+		if !ok {
+			time.Sleep(time.Duration(1+rand.Intn(5)) * time.Millisecond)
+			continue
+		}
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		m.commit(t)
+		done++
+	}
+}
+
+// analisa uma cópia do grafo de espera com o detector e, para cada ciclo
+// encontrado por getDeadlockPath que ainda existe, aborta a vítima escolhida
+func (m *LockManager) detect(policy Policy, policyName string) {
+	m.mu.Lock()
+	g := m.graph()
+	m.mu.Unlock()
+
+	d := newDetector("")
+	d.Quiet = true
+	d.Run(g)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byName := make(map[string]*Transaction)
+	for _, t := range m.Txns {
+		byName[t.Name] = t
+	}
+	for _, path := range d.Deadlocks() {
+		if !m.graph().hasCycle(path) {
+			fmt.Printf("O ciclo %v já foi desfeito\n", path)
+			continue
+		}
+		cycle := make([]*Transaction, 0, len(path))
+		for _, name := range path {
+			cycle = append(cycle, byName[name])
+		}
+		victim := policy(cycle)
+		fmt.Printf("# DEADLOCK - Ciclo %v; vítima %s (política %s)\n", path, victim.Name, policyName)
+		victim.aborted = true
+		m.releaseAll(victim)
+		m.Aborts++
+		m.Deadlocks++
+	}
+}
+
+// simula n transações disputando os recursos e detecta deadlocks a cada interval
+func runDynamic(n, nResources, want, rounds int, interval time.Duration, policyName string) {
+	m := newLockManager(n)
+	resources := make([]string, nResources)
+	for i := range resources {
+		resources[i] = fmt.Sprintf("R%d", i+1)
+	}
+	for _, t := range m.Txns {
+		fmt.Printf("%s começou (prioridade %d)\n", t.Name, t.Priority)
+	}
+
+	stop := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.detect(policies[policyName], policyName)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var w sync.WaitGroup
+	for _, t := range m.Txns {
+		w.Add(1)
+		go func(t *Transaction) {
+			defer w.Done()
+			m.run(t, resources, want, rounds)
+		}(t)
+	}
+	w.Wait()
+	close(stop)
+	<-monitorDone
+
+	fmt.Printf("Transações confirmadas: %d, abortadas: %d, deadlocks desfeitos: %d\n", m.Commits, m.Aborts, m.Deadlocks)
+}
+
+// grafo de espera (modelo AND) com n processos, em que cada processo espera
+// por cada um dos outros com probabilidade p
+func randomGraph(n int, p float64) *Graph {
+	g := newGraph()
+	for i := 1; i <= n; i++ {
+		g.addNode(fmt.Sprintf("P%d", i))
+	}
+	for _, from := range g.Names {
+		for _, to := range g.Names {
+			if from != to && rand.Float64() < p {
+				g.addEdge(from, to)
+			}
+		}
+	}
+	return g
+}
+
+// aplica ao grafo uma mudança possível, escolhida ao acaso: metade das vezes
+// um processo ativo atende um pedido feito a ele e, na outra metade, um
+// processo ativo faz um pedido novo, para que as esperas não se acumulem. Com
+// o pedido atendido, o processo precisa de um a menos; se era o último de que
+// precisava (sempre, no modelo OR), ele é liberado e deixa de esperar pelos
+// outros. Processos bloqueados só mudam quando são atendidos, então deadlocks
+// reais nunca somem
+func mutate(g *Graph) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grants := make([]func() string, 0)
+	requests := make([]func() string, 0)
+	for _, from := range g.Names {
+		from := from
+		for _, to := range g.Edges[from] {
+			to := to
+			if len(g.Edges[to]) == 0 {
+				grants = append(grants, func() string {
+					if g.need(from) > 1 {
+						g.removeEdge(from, to)
+						if k, ok := g.K[from]; ok {
+							g.K[from] = k - 1
+						}
+						return fmt.Sprintf("%s atendeu %s", to, from)
+					}
+					for _, other := range append([]string(nil), g.Edges[from]...) {
+						g.removeEdge(from, other)
+					}
+					delete(g.K, from)
+					return fmt.Sprintf("%s atendeu e liberou %s", to, from)
+				})
+			}
+		}
+		if len(g.Edges[from]) == 0 {
+			for _, to := range g.Names {
+				to := to
+				if to != from {
+					requests = append(requests, func() string {
+						g.addEdge(from, to)
+						return fmt.Sprintf("%s pediu a %s", from, to)
+					})
+				}
+			}
+		}
+	}
+	changes := grants
+	if len(grants) == 0 || len(requests) > 0 && rand.Intn(2) == 0 {
+		changes = requests
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	return changes[rand.Intn(len(changes))]()
+}
+
+/*
+* Uma rodada do teste de deadlocks fantasmas: o algoritmo alg analisa um grafo
+* aleatório enquanto ele muda por até mutations chamadas a mutate, como
+* acontece quando os processos atendem e fazem pedidos durante a detecção. As
+* mensagens atrasam até delay e as mudanças acontecem a intervalos de até delay.
+* O algoritmo or recebe o grafo com esperas OR
+* a: Resultado da análise
+* start, truth: Grafo no início e ao fim da detecção
+* changes: Mudanças aplicadas durante a detecção
+ */
+func phantomTrial(alg string, n, mutations int, delay time.Duration) (a *Analysis, start, truth *Graph, changes []string) {
+	live := randomGraph(n, 1/float64(n))
+	if alg == "or" {
+		for _, name := range live.Names {
+			if len(live.Edges[name]) > 0 {
+				live.K[name] = 1
+			}
+		}
+	}
+	start = live.clone()
+
+	stop := make(chan struct{})
+	var w sync.WaitGroup
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		for i := 0; i < mutations; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(rand.Int63n(int64(delay) + 1))):
+			}
+			if change := mutate(live); change != "" {
+				changes = append(changes, change)
+			}
+		}
+	}()
+	a = analyze("", live, []string{alg}, true, delay)
+	close(stop)
+	w.Wait()
+	return a, start, live.clone(), changes
+}
+
+// processos que cada algoritmo deveria apontar no grafo: dfs e cmh apontam os
+// processos em ciclos; or e bt, os que sobram na redução do grafo
+func expectedDeadlocks(g *Graph) map[string][]string {
+	cycles := nodesIn(g, g.elementaryCycles())
+	return map[string][]string{
+		"dfs": cycles,
+		"cmh": cycles,
+		"or":  g.deadlocked(),
+		"bt":  g.deadlocked(),
+	}
+}
+
+// elementos de list que não estão em other
+func missing(list, other []string) []string {
+	in := make(map[string]bool)
+	for _, name := range other {
+		in[name] = true
+	}
+	out := make([]string, 0)
+	for _, name := range list {
+		if !in[name] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+/*
+* Struct que representa o resultado do teste de deadlocks fantasmas
+* Trials, Changes: Rodadas de cada algoritmo e mudanças aplicadas em todas elas
+* Falses: Processos apontados por cada algoritmo que não estavam em deadlock ao fim da detecção
+* Misses: Processos em deadlock ao fim da detecção que cada algoritmo não apontou
+* Paths, Phantoms: Caminhos de dList e quantos deles não eram ciclos ao fim da detecção
+* Errors: Diferenças em rodadas em que o grafo não mudou. Sem mudanças nenhum
+* algoritmo pode errar, exceto a dfs, que perde os processos de ciclos sem
+* aresta de retorno na busca
+ */
+type PhantomStats struct {
+	Trials   int
+	Changes  int
+	Falses   map[string]int
+	Misses   map[string]int
+	Paths    int
+	Phantoms int
+	Errors   []string
+}
+
+// executa trials rodadas do teste de deadlocks fantasmas para cada algoritmo.
+// Cada caminho de dList também é conferido no grafo ao fim da detecção
+func runPhantom(trials, n, mutations int, delay time.Duration, algorithms []string, quiet bool) *PhantomStats {
+	s := &PhantomStats{Trials: trials, Falses: make(map[string]int), Misses: make(map[string]int)}
+
+	for trial := 1; trial <= trials; trial++ {
+		for _, alg := range algorithms {
+			a, start, truth, changes := phantomTrial(alg, n, mutations, delay)
+			expected := expectedDeadlocks(truth)
+			s.Changes += len(changes)
+
+			report := make([]string, 0)
+			if a.DFS != nil {
+				for _, path := range a.DFS.Deadlocks() {
+					s.Paths++
+					if !truth.hasCycle(path) {
+						s.Phantoms++
+						report = append(report, fmt.Sprintf("dList: o ciclo %v não existe", path))
+					}
+				}
+			}
+			r := a.results()[0]
+			wrong := missing(r.Nodes, expected[alg])
+			lost := missing(expected[alg], r.Nodes)
+			s.Falses[alg] += len(wrong)
+			s.Misses[alg] += len(lost)
+			if len(wrong) > 0 {
+				report = append(report, fmt.Sprintf("%s: falsos deadlocks %v", alg, wrong))
+			}
+			if len(changes) == 0 && (len(report) > 0 || len(lost) > 0 && alg != "dfs") {
+				s.Errors = append(s.Errors, fmt.Sprintf("rodada %d (%s), sem mudanças: apontou %v, esperados %v", trial, alg, r.Nodes, expected[alg]))
+			}
+			if len(report) > 0 && !quiet {
+				fmt.Printf("Rodada %d (%s) - mudanças durante a detecção: %v\n", trial, alg, changes)
+				fmt.Printf("Grafo no início:\n%sGrafo ao fim:\n%s", start.format(), truth.format())
+				for _, line := range report {
+					fmt.Printf("  ! %s\n", line)
+				}
+			}
+		}
+	}
+	return s
+}
+
+// imprime a contagem de falsos deadlocks e deadlocks perdidos por algoritmo
+func (s *PhantomStats) print(algorithms []string) {
+	fmt.Printf("%d rodadas por algoritmo, %d mudanças durante as detecções\n", s.Trials, s.Changes)
+	fmt.Printf("dList: %d caminhos, %d fantasmas\n", s.Paths, s.Phantoms)
+	fmt.Printf("%-10s %8s %9s\n", "Algoritmo", "Falsos", "Perdidos")
+	for _, alg := range algorithms {
+		fmt.Printf("%-10s %8d %9d\n", alg, s.Falses[alg], s.Misses[alg])
+	}
+	for _, e := range s.Errors {
+		fmt.Printf("  ! %s\n", e)
+	}
+}
+
+// grafo de espera com o ciclo S -> T -> N -> S
+func graphOne() *Graph {
+	g := newGraph()
+	g.Root = "P"
+	g.addEdge("P", "Q")
+	g.addEdge("P", "N")
+	g.addEdge("Q", "R")
+	g.addEdge("N", "S")
+	g.addEdge("S", "T")
+	g.addEdge("T", "N")
+	return g
+}
+
+// grafo de espera sem ciclos
+func graphTwo() *Graph {
+	g := newGraph()
+	g.Root = "P"
+	g.addEdge("P", "Q")
+	g.addEdge("P", "R")
+	g.addEdge("Q", "S")
+	g.addEdge("R", "S")
+	return g
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s [opções] [arquivo-do-grafo ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	algs := flag.String("alg", "dfs", "algoritmos separados por vírgula: dfs (busca em profundidade), cmh (sondas de Chandy-Misra-Haas), or (difusão de Chandy-Misra-Haas), bt (Bracha-Toueg)")
+	dynamic := flag.Bool("dynamic", false, "simula transações adquirindo e liberando travas, com detecção periódica")
+	policy := flag.String("policy", "youngest", "vítima de cada deadlock no modo -dynamic: youngest (mais jovem), fewest (menos travas), priority (menor prioridade)")
+	txns := flag.Int("tx", 4, "número de transações no modo -dynamic")
+	nResources := flag.Int("resources", 3, "número de recursos no modo -dynamic")
+	locks := flag.Int("locks", 2, "travas por transação no modo -dynamic")
+	rounds := flag.Int("rounds", 5, "vezes que cada transação precisa ser confirmada no modo -dynamic")
+	interval := flag.Duration("interval", 10*time.Millisecond, "intervalo entre as detecções no modo -dynamic")
+	phantom := flag.Int("phantom", 0, "executa o teste de deadlocks fantasmas com este número de rodadas")
+	nodes := flag.Int("nodes", 4, "processos em cada grafo do teste -phantom")
+	delay := flag.Duration("delay", 200*time.Microsecond, "atraso máximo das mensagens e intervalo máximo entre as mudanças no teste -phantom")
+	showStats := flag.Bool("stats", false, "imprime as mensagens por canal e por processo de cada detector por troca de mensagens")
+	jsonPath := flag.String("json", "", "grava o relatório de cada grafo em JSON neste arquivo (\"-\" para a saída padrão, sem o rastro)")
+	mutations := flag.Int("mutations", 4, "máximo de mudanças no grafo durante cada detecção do teste -phantom (até -nodes)")
+	flag.Parse()
+
+	if *dynamic {
+		if _, ok := policies[*policy]; !ok {
+			fmt.Fprintf(os.Stderr, "Política desconhecida: %q\n", *policy)
+			os.Exit(2)
+		}
+		if *txns < 1 || *locks < 1 || *locks > *nResources || *rounds < 1 || *interval <= 0 {
+			fmt.Fprintf(os.Stderr, "Use -tx, -locks e -rounds >= 1, -locks <= -resources e -interval > 0\n")
+			os.Exit(2)
+		}
+		runDynamic(*txns, *nResources, *locks, *rounds, *interval, *policy)
+		return
+	}
+
+	algorithms := strings.Split(*algs, ",")
+	for _, alg := range algorithms {
+		if alg != "dfs" && alg != "cmh" && alg != "or" && alg != "bt" {
+			fmt.Fprintf(os.Stderr, "Algoritmo desconhecido: %q\n", alg)
+			os.Exit(2)
+		}
+	}
+
+	if *phantom > 0 {
+		if *nodes < 2 || *mutations < 0 || *mutations > *nodes || *delay < 0 {
+			fmt.Fprintf(os.Stderr, "Use -nodes >= 2, 0 <= -mutations <= -nodes e -delay >= 0\n")
+			os.Exit(2)
+		}
+		stats := runPhantom(*phantom, *nodes, *mutations, *delay, algorithms, false)
+		stats.print(algorithms)
+		if len(stats.Errors) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Sem arquivos, analisa os grafos de exemplo
+	names := []string{"G1", "G2"}
+	graphs := []*Graph{graphOne(), graphTwo()}
+	if flag.NArg() > 0 {
+		names = flag.Args()
+		graphs = make([]*Graph, flag.NArg())
+		for i, path := range names {
+			g, err := loadGraph(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Erro ao ler %s: %v\n", path, err)
+				os.Exit(1)
+			}
+			graphs[i] = g
+		}
+	}
+
+	for _, alg := range algorithms {
+		if alg != "or" {
+			continue
+		}
+		for i, g := range graphs {
+			if and := g.andWaits(); len(and) > 0 {
+				fmt.Fprintf(os.Stderr, "%s: o algoritmo or só trata esperas OR (P -> Q | R), mas %v esperam por mais de um pedido\n", names[i], and)
+				os.Exit(2)
+			}
+		}
+	}
+
+	files := append([]string(nil), names...)
+	if len(graphs) == 1 {
+		names[0] = ""
+	}
+	quiet := *jsonPath == "-"
+
+	// Cada grafo é analisado por detectores próprios, em paralelo
+	results := make([]*Analysis, len(graphs))
+	var w sync.WaitGroup
+	for i, g := range graphs {
+		w.Add(1)
+		go func(i int, g *Graph) {
+			defer w.Done()
+			results[i] = analyze(names[i], g, algorithms, quiet, 0)
+		}(i, g)
+	}
+	w.Wait()
+
+	if !quiet {
+		for _, a := range results {
+			a.print()
+			if *showStats {
+				a.printStats()
+			}
+		}
+	}
+
+	if *jsonPath != "" {
+		reports := make([]Report, len(results))
+		for i, a := range results {
+			reports[i] = a.report(files[i])
+		}
+		if err := writeReports(*jsonPath, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "Erro ao gravar %s: %v\n", *jsonPath, err)
+			os.Exit(1)
+		}
 	}
 
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lê um grafo escrito no formato de parseGraph
+func mustParse(t *testing.T, text string) *Graph {
+	t.Helper()
+	g, err := parseGraph(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("grafo inválido: %v", err)
+	}
+	return g
+}
+
+// representa cada ciclo pelos seus processos em ordem alfabética, para que a
+// comparação não dependa do ponto de partida nem da ordem da busca
+func cycleSet(cycles [][]string) []string {
+	set := make([]string, 0, len(cycles))
+	for _, cycle := range cycles {
+		names := append([]string(nil), cycle...)
+		sort.Strings(names)
+		set = append(set, strings.Join(names, " "))
+	}
+	sort.Strings(set)
+	return set
+}
+
+func TestDetectorConcurrentGraphs(t *testing.T) {
+	cases := []struct {
+		name      string
+		graph     *Graph
+		deadlocks []string
+		cycles    []string
+	}{
+		{"um", graphOne(), []string{"N S T"}, []string{"N S T"}},
+		{"dois", graphTwo(), []string{}, []string{}},
+		{"laço", mustParse(t, "P -> P Q\nQ"), []string{"P"}, []string{"P"}},
+		{"componentes", mustParse(t, "A -> B\nB -> A\nC -> D\nD -> E\nE -> C\nF"), []string{"A B", "C D E"}, []string{"A B", "C D E"}},
+		{"dois ciclos", mustParse(t, "root P\nP -> Q\nQ -> R S\nR -> P\nS -> Q"), []string{"P Q R", "Q S"}, []string{"P Q R", "Q S"}},
+	}
+
+	// várias rodadas de cada grafo ao mesmo tempo, cada uma com seu detector e
+	// todas lendo o mesmo grafo
+	const rounds = 8
+	detectors := make([][]*Detector, len(cases))
+	var w sync.WaitGroup
+	for i, c := range cases {
+		detectors[i] = make([]*Detector, rounds)
+		for r := range detectors[i] {
+			d := newDetector(c.name)
+			d.Quiet = true
+			detectors[i][r] = d
+			w.Add(1)
+			go func(d *Detector, g *Graph) {
+				defer w.Done()
+				d.Run(g)
+			}(d, c.graph)
+		}
+	}
+	w.Wait()
+
+	for i, c := range cases {
+		for _, d := range detectors[i] {
+			if got := cycleSet(d.Deadlocks()); strings.Join(got, ",") != strings.Join(c.deadlocks, ",") {
+				t.Errorf("%s: deadlocks %v, esperados %v", c.name, got, c.deadlocks)
+			}
+			if got := cycleSet(d.Cycles()); strings.Join(got, ",") != strings.Join(c.cycles, ",") {
+				t.Errorf("%s: ciclos %v, esperados %v", c.name, got, c.cycles)
+			}
+		}
+	}
+
+	// o mesmo detector reaproveitado não carrega o resultado do grafo anterior
+	d := newDetector("reuso")
+	d.Quiet = true
+	d.Run(mustParse(t, "A -> B\nB -> A"))
+	d.Run(mustParse(t, "X -> Y\nY"))
+	if got := d.Deadlocks(); len(got) != 0 {
+		t.Errorf("reuso: deadlocks %v do grafo anterior", got)
+	}
+	if got := d.Edges(); len(got) != 1 || got[0].From != "X" || got[0].To != "Y" {
+		t.Errorf("reuso: arestas %v, esperada apenas X -> Y", got)
+	}
+	if order, ok := d.TopologicalOrder(); !ok || strings.Join(order, " ") != "X Y" {
+		t.Errorf("reuso: ordem topológica %v %v, esperada [X Y]", order, ok)
+	}
+
+	// execuções simultâneas no mesmo detector são serializadas
+	shared := newDetector("compartilhado")
+	shared.Quiet = true
+	for r := 0; r < rounds; r++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			shared.Run(cases[0].graph)
+		}()
+	}
+	w.Wait()
+	if got := cycleSet(shared.Deadlocks()); strings.Join(got, ",") != strings.Join(cases[0].deadlocks, ",") {
+		t.Errorf("compartilhado: deadlocks %v, esperados %v", got, cases[0].deadlocks)
+	}
+}
+
+func TestPhantomWithoutMutations(t *testing.T) {
+	algorithms := []string{"dfs", "cmh", "or", "bt"}
+	s := runPhantom(50, 5, 0, 100*time.Microsecond, algorithms, true)
+	for _, e := range s.Errors {
+		t.Error(e)
+	}
+	for _, alg := range algorithms {
+		if s.Falses[alg] > 0 {
+			t.Errorf("%s: %d falsos deadlocks sem mudanças no grafo", alg, s.Falses[alg])
+		}
+		if alg != "dfs" && s.Misses[alg] > 0 {
+			t.Errorf("%s: %d deadlocks perdidos sem mudanças no grafo", alg, s.Misses[alg])
+		}
+	}
+	if s.Phantoms > 0 {
+		t.Errorf("%d caminhos de dList não são ciclos", s.Phantoms)
+	}
+}
+
+// as mudanças do teste de deadlocks fantasmas nunca desfazem um deadlock, então
+// um falso deadlock é sempre erro do detector
+func TestMutateKeepsDeadlocks(t *testing.T) {
+	for trial := 0; trial < 200; trial++ {
+		g := randomGraph(5, 0.2)
+		if trial%2 == 1 {
+			for _, name := range g.Names {
+				if len(g.Edges[name]) > 0 {
+					g.K[name] = 1
+				}
+			}
+		}
+		for i := 0; i < 10; i++ {
+			before := g.deadlocked()
+			change := mutate(g)
+			if lost := missing(before, g.deadlocked()); len(lost) > 0 {
+				t.Fatalf("%q desfez o deadlock de %v:\n%s", change, lost, g.format())
+			}
+		}
+	}
+}
+
+// toda mensagem dos detectores por troca de mensagens é recebida e só circula
+// por arestas de espera, nos dois sentidos (respostas voltam pela aresta)
+func TestNetworkStats(t *testing.T) {
+	g := mustParse(t, "A -> B | C\nB -> A\nC -> A | B\nD -> A | E\nE")
+	a := analyze("", g, []string{"cmh", "or", "bt"}, true, 0)
+	for alg, n := range map[string]*network{"cmh": &a.Probe.network, "or": &a.Query.network, "bt": &a.Notify.network} {
+		s := n.Stats
+		sent, received := 0, 0
+		for _, count := range s.Sent {
+			sent += count
+		}
+		for _, count := range s.Received {
+			received += count
+		}
+		if sent != s.Messages || received != s.Messages {
+			t.Errorf("%s: %d mensagens, %d enviadas e %d recebidas", alg, s.Messages, sent, received)
+		}
+		for link := range s.PerLink {
+			if link.From == "detector" || link.To == "detector" {
+				continue
+			}
+			if !contains(g.Edges[link.From], link.To) && !contains(g.Edges[link.To], link.From) {
+				t.Errorf("%s: mensagem de %s para %s, que não têm aresta de espera", alg, link.From, link.To)
+			}
+		}
+		if s.Depth < 1 || s.Depth > s.Messages {
+			t.Errorf("%s: profundidade causal %d com %d mensagens", alg, s.Depth, s.Messages)
+		}
+	}
+}
+
+// a busca em profundidade troca uma autorização e um aviso de fim por aresta
+// da árvore, uma mensagem de cada vez, então a profundidade causal é o total
+func TestDetectorStats(t *testing.T) {
+	for _, g := range []*Graph{graphOne(), graphTwo(), mustParse(t, "A -> B\nB -> A\nC -> D\nD -> E\nE -> C\nF")} {
+		d := newDetector("")
+		d.Quiet = true
+		d.Run(g)
+		s, tree := d.Stats, d.edgeCounts()[TreeEdge]
+		if s.Messages != 2*tree || s.ByKind["authorize"] != tree || s.ByKind["done"] != tree {
+			t.Errorf("%d mensagens (%v) para %d arestas da árvore", s.Messages, s.ByKind, tree)
+		}
+		for _, name := range g.Names {
+			if s.Sent[name] != s.Received[name] {
+				t.Errorf("%s enviou %d e recebeu %d mensagens", name, s.Sent[name], s.Received[name])
+			}
+		}
+		for link := range s.PerLink {
+			if !contains(g.Edges[link.From], link.To) && !contains(g.Edges[link.To], link.From) {
+				t.Errorf("mensagem de %s para %s, que não têm aresta de espera", link.From, link.To)
+			}
+		}
+		if longest := 2 * (len(g.Names) - 1); s.Depth > s.Messages || s.Depth > longest {
+			t.Errorf("profundidade causal %d com %d mensagens", s.Depth, s.Messages)
+		}
+	}
+}
+
+func contains(list []string, name string) bool {
+	for _, other := range list {
+		if other == name {
+			return true
+		}
+	}
+	return false
+}
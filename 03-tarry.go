@@ -1,13 +1,97 @@
-// Implementação do algoritmo de travessia de Tarry
+// Implementação do algoritmo de travessia de Tarry, das buscas em profundidade
+// de Awerbuch e de Cidon e do algoritmo de onda Echo
 package main
 
 import (
+	"flag"
 	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Tipos de mensagem
+const (
+	TokenMsg   = "token"   // o token da travessia
+	VisitedMsg = "visited" // avisa aos vizinhos que o processo já foi visitado
+	AckMsg     = "ack"     // confirma o recebimento de um aviso (Awerbuch)
+	ExploreMsg = "explore" // propaga a onda (Echo)
+	EchoMsg    = "echo"    // devolve ao pai o valor agregado da subárvore (Echo)
+)
+
+/*
+* Struct que representa o valor parcial de uma agregação
+* Value: Resultado numérico (soma, mínimo, máximo ou contagem)
+* Ids: Processos coletados
+ */
+type Partial struct {
+	Value int
+	Ids   []string
+}
+
+/*
+* Struct que representa uma agregação calculada pela onda
+* Start: Valor parcial de um processo sozinho
+* Merge: Combina dois valores parciais; deve ser associativa e comutativa
+ */
+type Aggregator struct {
+	Start func(id string, value int) Partial
+	Merge func(a, b Partial) Partial
+}
+
+// agregações disponíveis
+var aggregators = map[string]Aggregator{
+	"sum": {
+		Start: func(id string, value int) Partial { return Partial{Value: value} },
+		Merge: func(a, b Partial) Partial { return Partial{Value: a.Value + b.Value} },
+	},
+	"min": {
+		Start: func(id string, value int) Partial { return Partial{Value: value} },
+		Merge: func(a, b Partial) Partial {
+			if b.Value < a.Value {
+				return b
+			}
+			return a
+		},
+	},
+	"max": {
+		Start: func(id string, value int) Partial { return Partial{Value: value} },
+		Merge: func(a, b Partial) Partial {
+			if b.Value > a.Value {
+				return b
+			}
+			return a
+		},
+	},
+	"count": {
+		Start: func(id string, value int) Partial { return Partial{Value: 1} },
+		Merge: func(a, b Partial) Partial { return Partial{Value: a.Value + b.Value} },
+	},
+	"ids": {
+		Start: func(id string, value int) Partial { return Partial{Ids: []string{id}} },
+		Merge: func(a, b Partial) Partial {
+			ids := append(append([]string(nil), a.Ids...), b.Ids...)
+			sort.Strings(ids)
+			return Partial{Ids: ids}
+		},
+	},
+}
+
+/*
+* Struct que representa as mensagens trocadas pelos processos
+* Sender: Processo que enviou a mensagem ("init" para o iniciador)
+* Kind: token, visited, ack, explore ou echo (vazio vale como token)
+* Time: Tempo da mensagem, supondo que cada mensagem leva uma unidade de tempo
+* Data: Valor agregado levado pelo echo
+ */
 type Token struct {
 	Sender string
+	Kind   string
+	Time   int
+	Data   Partial
 }
 
 type Neighbour struct {
@@ -15,10 +99,217 @@ type Neighbour struct {
 	Pass chan Token
 }
 
-func newNode(value string) *Neighbour {
+// cria um processo cujo canal comporta capacity mensagens sem bloquear o remetente
+func newNode(value string, capacity int) *Neighbour {
 	return &Neighbour{
 		Id:   value,
-		Pass: make(chan Token, 1),
+		Pass: make(chan Token, capacity),
+	}
+}
+
+/*
+* Struct que representa um canal em um sentido: de From para To
+ */
+type Link struct {
+	From string
+	To   string
+}
+
+/*
+* Struct que mede uma execução. Cópia da de 02-deadlock-goroutines.go (não há módulo comum); mantenha as duas iguais
+* Messages: Total de mensagens enviadas
+* ByKind: Mensagens de cada tipo
+* PerLink: Mensagens em cada canal, por sentido
+* Sent, Received: Mensagens enviadas e recebidas por cada processo
+* Depth: Profundidade causal: a maior cadeia de mensagens em que cada uma foi
+* enviada depois de a anterior chegar. É a duração da execução quando cada
+* mensagem leva uma unidade de tempo e o processamento local é instantâneo
+ */
+type Stats struct {
+	Messages int
+	ByKind   map[string]int
+	PerLink  map[Link]int
+	Sent     map[string]int
+	Received map[string]int
+	Depth    int
+	mu       sync.Mutex
+}
+
+func newStats() *Stats {
+	return &Stats{
+		ByKind:   make(map[string]int),
+		PerLink:  make(map[Link]int),
+		Sent:     make(map[string]int),
+		Received: make(map[string]int),
+	}
+}
+
+// registra o envio de uma mensagem do tipo kind de from para to; time é o
+// tamanho da cadeia causal que termina nela
+func (s *Stats) send(from, to, kind string, time int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Messages++
+	s.ByKind[kind]++
+	s.PerLink[Link{from, to}]++
+	s.Sent[from]++
+	if time > s.Depth {
+		s.Depth = time
+	}
+}
+
+// registra que to recebeu uma mensagem
+func (s *Stats) receive(to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Received[to]++
+}
+
+// imprime as medidas; ids define a ordem dos processos
+func (s *Stats) print(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kinds := make([]string, 0, len(s.ByKind))
+	for kind, n := range s.ByKind {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", kind, n))
+	}
+	sort.Strings(kinds)
+	fmt.Printf("Mensagens: %d (%s), profundidade causal: %d\n", s.Messages, strings.Join(kinds, " "), s.Depth)
+
+	links := make([]Link, 0, len(s.PerLink))
+	for link := range s.PerLink {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].From != links[j].From {
+			return links[i].From < links[j].From
+		}
+		return links[i].To < links[j].To
+	})
+	fmt.Println("Mensagens por canal:")
+	for _, link := range links {
+		fmt.Printf("  %s -> %s: %d\n", link.From, link.To, s.PerLink[link])
+	}
+	fmt.Println("Mensagens por processo (enviadas/recebidas):")
+	for _, id := range ids {
+		fmt.Printf("  %s: %d/%d\n", id, s.Sent[id], s.Received[id])
+	}
+}
+
+/*
+* Struct que reúne o que os processos compartilham em uma execução
+* Tree: Árvore geradora construída pelo token
+* Stats: Medidas das mensagens trocadas
+* Delay: Atraso máximo de cada mensagem; com atraso, as mensagens podem chegar fora de ordem
+* Quiet: Não imprime o rastro da travessia
+* Aggregator, Values: Agregação calculada pela onda Echo e o valor de cada processo
+* Result: Valor agregado que chegou ao iniciador da onda Echo
+* done: Fechado pelo iniciador quando o token volta para ele pela última vez
+* quit: Fechado quando a execução termina, para que os processos parem de esperar mensagens
+* inFlight: Mensagens enviadas e ainda não recebidas
+ */
+type Traversal struct {
+	Tree       *SpanningTree
+	Stats      *Stats
+	Delay      time.Duration
+	Quiet      bool
+	Aggregator Aggregator
+	Values     map[string]int
+	Result     Partial
+	done       chan struct{}
+	quit       chan struct{}
+	inFlight   sync.WaitGroup
+}
+
+// envia a mensagem do tipo kind de from para to, com o tempo seguinte ao relógio do remetente
+func (t *Traversal) send(from string, clock int, kind string, to *Neighbour) {
+	t.post(Token{Sender: from, Kind: kind, Time: clock + 1}, to)
+}
+
+// entrega a mensagem token a to, com o atraso configurado
+func (t *Traversal) post(token Token, to *Neighbour) {
+	t.Stats.send(token.Sender, to.Id, token.Kind, token.Time)
+	t.inFlight.Add(1)
+	if t.Delay <= 0 {
+		to.Pass <- token
+		return
+	}
+	delay := time.Duration(rand.Int63n(int64(t.Delay)))
+	go func() {
+		time.Sleep(delay)
+		to.Pass <- token
+	}()
+}
+
+// imprime o rastro da travessia, a menos que ela seja silenciosa
+func (t *Traversal) logf(format string, args ...interface{}) {
+	if !t.Quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// registra que o processo at recebeu uma mensagem
+func (t *Traversal) received(at *Neighbour) {
+	t.Stats.receive(at.Id)
+	t.inFlight.Done()
+}
+
+/*
+* Struct que representa a árvore geradora construída pela travessia
+* Root: Processo iniciador
+* Parent: Pai de cada processo (o primeiro que lhe enviou o token)
+* Children: Filhos de cada processo, na ordem em que foram descobertos
+* Depth: Distância de cada processo até a raiz na árvore
+* Route: Processos por onde o token passou, em ordem; cada par consecutivo é uma mensagem
+ */
+type SpanningTree struct {
+	Root     string
+	Parent   map[string]string
+	Children map[string][]string
+	Depth    map[string]int
+	Route    []string
+	mu       sync.Mutex
+}
+
+func newSpanningTree(root string) *SpanningTree {
+	return &SpanningTree{
+		Root:     root,
+		Parent:   make(map[string]string),
+		Children: make(map[string][]string),
+		Depth:    map[string]int{root: 0},
+		Route:    []string{root},
+	}
+}
+
+// registra a chegada do token ao processo to
+func (t *SpanningTree) pass(to string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Route = append(t.Route, to)
+}
+
+// registra que parent é pai de child
+func (t *SpanningTree) adopt(parent, child string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Parent[child] = parent
+	t.Children[parent] = append(t.Children[parent], child)
+	t.Depth[child] = t.Depth[parent] + 1
+}
+
+// imprime a árvore a partir da raiz, um processo por linha, indentado pela profundidade
+func (t *SpanningTree) print() {
+	var visit func(id string)
+	visit = func(id string) {
+		fmt.Printf("%s%s (profundidade %d)\n", strings.Repeat("  ", t.Depth[id]), id, t.Depth[id])
+		for _, child := range t.Children[id] {
+			visit(child)
+		}
+	}
+	fmt.Println("Árvore geradora:")
+	visit(t.Root)
+	if len(t.Route) > 1 {
+		fmt.Printf("Rota do token: %s\n", strings.Join(t.Route, " -> "))
 	}
 }
 
@@ -27,8 +318,7 @@ func redirect(in chan Token, neigh *Neighbour) {
 	in <- token
 }
 
-func process(w *sync.WaitGroup, currentNode *Neighbour, token Token, neighs ...*Neighbour) {
-	var pai Neighbour
+func process(w *sync.WaitGroup, t *Traversal, currentNode *Neighbour, token Token, neighs ...*Neighbour) {
 
 	defer w.Done()
 
@@ -38,68 +328,530 @@ func process(w *sync.WaitGroup, currentNode *Neighbour, token Token, neighs ...*
 	}
 
 	if token.Sender == "init" {
-		// Processo iniciador
-		fmt.Printf("* %s é raiz.\n", currentNode.Id)
-		token.Sender = currentNode.Id
-		neighs[0].Pass <- token
-		size := len(neighs)
-		for i := 1; i < size; i++ {
-			tk := <-currentNode.Pass
-			fmt.Printf("From %s to %s\n", tk.Sender, currentNode.Id)
-			tk.Sender = currentNode.Id
-			neighs[i].Pass <- tk
+		// Processo iniciador: envia o token a cada vizinho e espera que ele volte
+		t.logf("* %s é raiz.\n", currentNode.Id)
+		for _, neigh := range neighs {
+			t.send(currentNode.Id, token.Time, TokenMsg, neigh)
+			token = <-currentNode.Pass
+			t.received(currentNode)
+			t.logf("From %s to %s\n", token.Sender, currentNode.Id)
+			t.Tree.pass(currentNode.Id)
 		}
-		tk := <-currentNode.Pass
-		fmt.Printf("From %s to %s\n", tk.Sender, currentNode.Id)
-		fmt.Println("Fim!")
+		t.logf("Fim!\n")
+		close(t.done)
 	} else {
-		// Processo não iniciador
+		// Processo não iniciador: quem enviou o token pela primeira vez é o pai
 		tk := <-currentNode.Pass
-		fmt.Printf("From %s to %s\n", tk.Sender, currentNode.Id)
+		t.received(currentNode)
+		t.logf("From %s to %s\n", tk.Sender, currentNode.Id)
+		t.Tree.pass(currentNode.Id)
+		// o remetente está sempre em nmap: só vizinhos enviam o token e connect
+		// liga os dois sentidos de cada aresta
+		pai := nmap[tk.Sender]
+		t.logf("* %s é pai de %s\n", pai.Id, currentNode.Id)
+		t.Tree.adopt(pai.Id, currentNode.Id)
 		for _, neigh := range neighs {
-			if pai.Id == "" {
-				pai = *nmap[tk.Sender]
-				fmt.Printf("* %s é pai de %s\n", pai.Id, currentNode.Id)
-			}
 			// Entrega o token para o vizinho se ele não for o pai
 			if pai.Id != neigh.Id {
-				tk.Sender = currentNode.Id
-				neigh.Pass <- tk
+				t.send(currentNode.Id, tk.Time, TokenMsg, neigh)
 				tk = <-currentNode.Pass
-				fmt.Printf("From %s to %s\n", tk.Sender, currentNode.Id)
+				t.received(currentNode)
+				t.logf("From %s to %s\n", tk.Sender, currentNode.Id)
+				t.Tree.pass(currentNode.Id)
 			}
 		}
 		// Token volta para o pai depois de ter passado enviado para todos os vizinhos
-		tk.Sender = currentNode.Id
-		pai.Pass <- tk
+		t.send(currentNode.Id, tk.Time, TokenMsg, pai)
 	}
 
 }
 
-func main() {
+/*
+* Busca em profundidade de Awerbuch. Ao receber o token pela primeira vez, o
+* processo avisa todos os vizinhos (menos o pai) de que foi visitado e só passa
+* o token adiante depois de receber a confirmação de cada um. Assim ninguém
+* envia o token a um processo já visitado: o token só percorre as arestas da
+* árvore, ao custo de até 4|E| mensagens e tempo de até 4|V|-2
+ */
+func awerbuch(w *sync.WaitGroup, t *Traversal, currentNode *Neighbour, token Token, neighs ...*Neighbour) {
 
-	pNode := newNode("P")
-	qNode := newNode("Q")
-	rNode := newNode("R")
-	sNode := newNode("S")
-	wNode := newNode("W")
+	defer w.Done()
 
-	var w sync.WaitGroup
+	initiator := token.Sender == "init"
+	visited := make(map[string]bool) // vizinhos que já foram visitados
+	var parent *Neighbour
+	clock, acks := 0, 0
 
-	w.Add(1)
-	go process(&w, wNode, Token{}, pNode, sNode)
+	// passa o token ao próximo vizinho não visitado ou, se não houver, devolve ao pai
+	forward := func() {
+		for _, neigh := range neighs {
+			if !visited[neigh.Id] && neigh != parent {
+				visited[neigh.Id] = true
+				t.send(currentNode.Id, clock, TokenMsg, neigh)
+				return
+			}
+		}
+		if parent != nil {
+			t.send(currentNode.Id, clock, TokenMsg, parent)
+		} else {
+			t.logf("Fim!\n")
+			close(t.done)
+		}
+	}
+	visit := func() {
+		for _, neigh := range neighs {
+			if neigh != parent {
+				t.send(currentNode.Id, clock, VisitedMsg, neigh)
+				acks++
+			}
+		}
+		if acks == 0 {
+			forward()
+		}
+	}
 
-	w.Add(1)
-	go process(&w, sNode, Token{}, pNode, wNode)
+	if initiator {
+		t.logf("* %s é raiz.\n", currentNode.Id)
+		visit()
+	}
+	nmap := make(map[string]*Neighbour)
+	for _, neigh := range neighs {
+		nmap[neigh.Id] = neigh
+	}
+
+	for {
+		select {
+		case tk := <-currentNode.Pass:
+			t.received(currentNode)
+			if tk.Time > clock {
+				clock = tk.Time
+			}
+			switch tk.Kind {
+			case VisitedMsg:
+				visited[tk.Sender] = true
+				t.send(currentNode.Id, clock, AckMsg, nmap[tk.Sender])
+			case AckMsg:
+				acks--
+				if acks == 0 {
+					forward()
+				}
+			default:
+				t.logf("From %s to %s\n", tk.Sender, currentNode.Id)
+				t.Tree.pass(currentNode.Id)
+				if parent == nil && !initiator {
+					// primeira visita: quem enviou o token é o pai
+					parent = nmap[tk.Sender]
+					t.logf("* %s é pai de %s\n", parent.Id, currentNode.Id)
+					t.Tree.adopt(parent.Id, currentNode.Id)
+					visit()
+				} else {
+					// o filho devolveu o token
+					forward()
+				}
+			}
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+/*
+* Busca em profundidade de Cidon. Ao receber o token pela primeira vez, o
+* processo avisa os vizinhos (menos o pai) de que foi visitado e passa o token
+* adiante sem esperar confirmações. Se o token chega a um processo já visitado,
+* ele é descartado: o aviso desse processo, ao chegar a quem enviou o token,
+* vale como devolução. São até 4|E| mensagens, mas o tempo cai para até 2|V|-2
+ */
+func cidon(w *sync.WaitGroup, t *Traversal, currentNode *Neighbour, token Token, neighs ...*Neighbour) {
 
-	w.Add(1)
-	go process(&w, rNode, Token{}, qNode, pNode)
+	defer w.Done()
 
-	w.Add(1)
-	go process(&w, qNode, Token{}, rNode)
+	initiator := token.Sender == "init"
+	visited := make(map[string]bool) // vizinhos que já foram visitados
+	var parent *Neighbour
+	target := "" // vizinho com quem está o token
+	clock := 0
 
-	w.Add(1)
-	go process(&w, pNode, Token{"init"}, wNode, sNode, rNode)
+	// passa o token ao próximo vizinho não visitado ou, se não houver, devolve ao pai
+	forward := func() {
+		target = ""
+		for _, neigh := range neighs {
+			if !visited[neigh.Id] && neigh != parent {
+				visited[neigh.Id] = true
+				target = neigh.Id
+				t.send(currentNode.Id, clock, TokenMsg, neigh)
+				return
+			}
+		}
+		if parent != nil {
+			t.send(currentNode.Id, clock, TokenMsg, parent)
+		} else {
+			t.logf("Fim!\n")
+			close(t.done)
+		}
+	}
+	visit := func() {
+		for _, neigh := range neighs {
+			if neigh != parent {
+				t.send(currentNode.Id, clock, VisitedMsg, neigh)
+			}
+		}
+		forward()
+	}
 
+	if initiator {
+		t.logf("* %s é raiz.\n", currentNode.Id)
+		visit()
+	}
+	nmap := make(map[string]*Neighbour)
+	for _, neigh := range neighs {
+		nmap[neigh.Id] = neigh
+	}
+	first := !initiator
+
+	for {
+		select {
+		case tk := <-currentNode.Pass:
+			t.received(currentNode)
+			if tk.Time > clock {
+				clock = tk.Time
+			}
+			switch {
+			case tk.Kind == VisitedMsg:
+				visited[tk.Sender] = true
+				if tk.Sender == target {
+					// o token foi descartado pelo vizinho, que já tinha sido visitado
+					forward()
+				}
+			case first:
+				first = false
+				t.logf("From %s to %s\n", tk.Sender, currentNode.Id)
+				t.Tree.pass(currentNode.Id)
+				parent = nmap[tk.Sender]
+				t.logf("* %s é pai de %s\n", parent.Id, currentNode.Id)
+				t.Tree.adopt(parent.Id, currentNode.Id)
+				visit()
+			case tk.Sender == target:
+				// o filho devolveu o token
+				t.logf("From %s to %s\n", tk.Sender, currentNode.Id)
+				t.Tree.pass(currentNode.Id)
+				forward()
+			default:
+				// token enviado antes de o remetente receber o aviso deste processo
+				t.logf("%s descartou o token de %s\n", currentNode.Id, tk.Sender)
+				visited[tk.Sender] = true
+			}
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+/*
+* Algoritmo de onda Echo. O iniciador envia explore a todos os vizinhos; cada
+* processo adota como pai quem lhe enviou o primeiro explore e repassa o explore
+* aos demais vizinhos. Quando já recebeu uma mensagem (explore ou echo) de cada
+* vizinho, o processo envia ao pai um echo com o valor agregado da sua
+* subárvore. A onda termina quando o iniciador recebe de todos os vizinhos,
+* com 2|E| mensagens
+ */
+func echo(w *sync.WaitGroup, t *Traversal, currentNode *Neighbour, token Token, neighs ...*Neighbour) {
+
+	defer w.Done()
+
+	initiator := token.Sender == "init"
+	partial := t.Aggregator.Start(currentNode.Id, t.Values[currentNode.Id])
+	var parent *Neighbour
+	received, clock := 0, 0
+
+	nmap := make(map[string]*Neighbour)
+	for _, neigh := range neighs {
+		nmap[neigh.Id] = neigh
+	}
+
+	if initiator {
+		t.logf("* %s é raiz.\n", currentNode.Id)
+		for _, neigh := range neighs {
+			t.send(currentNode.Id, clock, ExploreMsg, neigh)
+		}
+	}
+
+	for received < len(neighs) {
+		tk := <-currentNode.Pass
+		t.received(currentNode)
+		received++
+		if tk.Time > clock {
+			clock = tk.Time
+		}
+		t.logf("(%s) %s -> %s\n", tk.Kind, tk.Sender, currentNode.Id)
+		if tk.Kind == EchoMsg {
+			partial = t.Aggregator.Merge(partial, tk.Data)
+		}
+		if tk.Kind == ExploreMsg && parent == nil && !initiator {
+			parent = nmap[tk.Sender]
+			t.logf("* %s é pai de %s\n", parent.Id, currentNode.Id)
+			t.Tree.adopt(parent.Id, currentNode.Id)
+			for _, neigh := range neighs {
+				if neigh != parent {
+					t.send(currentNode.Id, clock, ExploreMsg, neigh)
+				}
+			}
+		}
+	}
+
+	if initiator {
+		t.Result = partial
+		t.logf("Fim!\n")
+		close(t.done)
+	} else {
+		t.post(Token{Sender: currentNode.Id, Kind: EchoMsg, Time: clock + 1, Data: partial}, parent)
+	}
+}
+
+// algoritmos de travessia disponíveis
+var traversals = map[string]func(*sync.WaitGroup, *Traversal, *Neighbour, Token, ...*Neighbour){
+	"tarry":    process,
+	"awerbuch": awerbuch,
+	"cidon":    cidon,
+	"echo":     echo,
+}
+
+/*
+* Struct que representa uma topologia não direcionada
+* Ids: Processos na ordem em que foram criados
+* Adj: Vizinhos de cada processo, na ordem em que o token é enviado a eles
+* Values: Valor de cada processo, agregado pela onda Echo (por padrão, a sua posição)
+ */
+type Graph struct {
+	Ids    []string
+	Adj    map[string][]string
+	Values map[string]int
+}
+
+func newGraph(ids ...string) *Graph {
+	g := &Graph{Adj: make(map[string][]string), Values: make(map[string]int)}
+	for _, id := range ids {
+		g.add(id)
+	}
+	return g
+}
+
+// adiciona o processo, se ele ainda não existir
+func (g *Graph) add(id string) {
+	if _, ok := g.Adj[id]; !ok {
+		g.Ids = append(g.Ids, id)
+		g.Adj[id] = make([]string, 0)
+		g.Values[id] = len(g.Ids)
+	}
+}
+
+// liga a e b nos dois sentidos; laços e arestas repetidas são ignorados
+func (g *Graph) connect(a, b string) {
+	g.add(a)
+	g.add(b)
+	if a == b {
+		return
+	}
+	for _, id := range g.Adj[a] {
+		if id == b {
+			return
+		}
+	}
+	g.Adj[a] = append(g.Adj[a], b)
+	g.Adj[b] = append(g.Adj[b], a)
+}
+
+// número de arestas
+func (g *Graph) edges() int {
+	total := 0
+	for _, id := range g.Ids {
+		total += len(g.Adj[id])
+	}
+	return total / 2
+}
+
+// verifica se root existe e alcança todos os processos: senão, quem não recebe
+// o token ficaria esperando para sempre
+func (g *Graph) validate(root string) error {
+	if _, ok := g.Adj[root]; !ok {
+		return fmt.Errorf("o iniciador %s não pertence ao grafo", root)
+	}
+	seen := map[string]bool{root: true}
+	stack := []string{root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range g.Adj[id] {
+			if !seen[next] {
+				seen[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	for _, id := range g.Ids {
+		if !seen[id] {
+			return fmt.Errorf("o grafo não é conexo: %s não é alcançável a partir de %s", id, root)
+		}
+	}
+	return nil
+}
+
+// cria um processo para cada nó e executa a travessia alg a partir de root. A
+// agregação agg só é usada pela onda Echo, cujo resultado fica em t.Result
+func (g *Graph) traverse(alg, root string, delay time.Duration, agg Aggregator, quiet bool) (*Traversal, error) {
+	if err := g.validate(root); err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*Neighbour)
+	for _, id := range g.Ids {
+		// cada vizinho envia no máximo um token, um aviso, uma confirmação e uma
+		// devolução por aresta, então o canal nunca bloqueia o remetente
+		nodes[id] = newNode(id, 4*len(g.Adj[id])+1)
+	}
+
+	var w sync.WaitGroup
+	t := &Traversal{
+		Tree:       newSpanningTree(root),
+		Stats:      newStats(),
+		Delay:      delay,
+		Quiet:      quiet,
+		Aggregator: agg,
+		Values:     g.Values,
+		done:       make(chan struct{}),
+		quit:       make(chan struct{}),
+	}
+	for _, id := range g.Ids {
+		neighs := make([]*Neighbour, 0, len(g.Adj[id]))
+		for _, next := range g.Adj[id] {
+			neighs = append(neighs, nodes[next])
+		}
+		token := Token{}
+		if id == root {
+			token.Sender = "init"
+		}
+		w.Add(1)
+		go traversals[alg](&w, t, nodes[id], token, neighs...)
+	}
+	<-t.done
+	t.inFlight.Wait()
+	close(t.quit)
 	w.Wait()
+	return t, nil
+}
+
+// grafo conexo aleatório com n processos: uma árvore aleatória mais cada
+// aresta restante com probabilidade p
+func randomGraph(n int, p float64) *Graph {
+	g := newGraph()
+	for i := 1; i <= n; i++ {
+		g.add(fmt.Sprintf("P%d", i))
+	}
+	for i := 1; i < n; i++ {
+		g.connect(g.Ids[i], g.Ids[rand.Intn(i)])
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if rand.Float64() < p {
+				g.connect(g.Ids[i], g.Ids[j])
+			}
+		}
+		g.Values[g.Ids[i]] = rand.Intn(100)
+	}
+	// embaralha a ordem dos vizinhos, que define o caminho do token
+	for _, id := range g.Ids {
+		rand.Shuffle(len(g.Adj[id]), func(i, j int) {
+			g.Adj[id][i], g.Adj[id][j] = g.Adj[id][j], g.Adj[id][i]
+		})
+	}
+	return g
+}
+
+// imprime as mensagens e o tempo de cada travessia, ao lado dos limites teóricos
+func printComparison(g *Graph, algs []string, stats []*Stats) {
+	v, e := len(g.Ids), g.edges()
+	bounds := map[string]string{
+		"tarry":    fmt.Sprintf("2|E| = %d mensagens, tempo 2|E| = %d", 2*e, 2*e),
+		"awerbuch": fmt.Sprintf("4|E| = %d mensagens, tempo 4|V|-2 = %d", 4*e, 4*v-2),
+		"cidon":    fmt.Sprintf("4|E| = %d mensagens, tempo 2|V|-2 = %d", 4*e, 2*v-2),
+		"echo":     fmt.Sprintf("2|E| = %d mensagens", 2*e),
+	}
+	fmt.Printf("Comparação em %d processos e %d arestas:\n", v, e)
+	fmt.Printf("%-9s %9s %12s  %-28s %s\n", "Algoritmo", "Mensagens", "Profundidade", "Por tipo", "Limites")
+	for i, alg := range algs {
+		c := stats[i]
+		kinds := make([]string, 0)
+		for _, kind := range []string{TokenMsg, VisitedMsg, AckMsg, ExploreMsg, EchoMsg} {
+			if c.ByKind[kind] > 0 {
+				kinds = append(kinds, fmt.Sprintf("%s=%d", kind, c.ByKind[kind]))
+			}
+		}
+		fmt.Printf("%-9s %9d %12d  %-28s %s\n", alg, c.Messages, c.Depth, strings.Join(kinds, " "), bounds[alg])
+	}
+}
+
+// topologia de exemplo: P liga-se a W, S e R; W a S; R a Q
+func exampleGraph() *Graph {
+	g := newGraph()
+	g.connect("P", "W")
+	g.connect("P", "S")
+	g.connect("Q", "R")
+	g.connect("P", "R")
+	g.connect("W", "S")
+	return g
+}
+
+func main() {
+
+	root := flag.String("root", "P", "processo iniciador da topologia de exemplo")
+	algs := flag.String("alg", "tarry", "travessias separadas por vírgula: tarry, awerbuch, cidon, echo")
+	aggName := flag.String("agg", "sum", "agregação da onda echo: sum, min, max, count, ids")
+	showStats := flag.Bool("stats", false, "imprime as mensagens por canal e por processo de cada execução")
+	delay := flag.Duration("delay", 0, "atraso máximo de cada mensagem (ex: 1ms)")
+	flag.Parse()
+
+	algorithms := strings.Split(*algs, ",")
+	for _, alg := range algorithms {
+		if _, ok := traversals[alg]; !ok {
+			fmt.Fprintf(os.Stderr, "Travessia desconhecida: %q\n", alg)
+			os.Exit(2)
+		}
+	}
+	agg, ok := aggregators[*aggName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Agregação desconhecida: %q\n", *aggName)
+		os.Exit(2)
+	}
+
+	g := exampleGraph()
+	stats := make([]*Stats, len(algorithms))
+	for i, alg := range algorithms {
+		if len(algorithms) > 1 {
+			fmt.Printf("== %s ==\n", alg)
+		}
+		t, err := g.traverse(alg, *root, *delay, agg, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Erro: %v\n", err)
+			os.Exit(1)
+		}
+		t.Tree.print()
+		if alg == "echo" {
+			values := make([]string, 0, len(g.Ids))
+			for _, id := range g.Ids {
+				values = append(values, fmt.Sprintf("%s=%d", id, g.Values[id]))
+			}
+			fmt.Printf("Valores: %s\n", strings.Join(values, " "))
+			if *aggName == "ids" {
+				fmt.Printf("Resultado da onda (%s): %v\n", *aggName, t.Result.Ids)
+			} else {
+				fmt.Printf("Resultado da onda (%s): %d\n", *aggName, t.Result.Value)
+			}
+		}
+		if *showStats {
+			t.Stats.print(g.Ids)
+		}
+		stats[i] = t.Stats
+	}
+	if len(algorithms) > 1 {
+		printComparison(g, algorithms, stats)
+	}
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// topologias aleatórias mais os casos de borda: um único processo, um
+// caminho (cujas pontas são folhas) e uma estrela
+func tarryGraphs() []*Graph {
+	path := newGraph()
+	path.connect("P1", "P2")
+	path.connect("P2", "P3")
+	star := newGraph()
+	for _, leaf := range []string{"P2", "P3", "P4", "P5"} {
+		star.connect("P1", leaf)
+	}
+	graphs := []*Graph{newGraph("P1"), path, star, exampleGraph()}
+	for i := 0; i < 300; i++ {
+		graphs = append(graphs, randomGraph(1+rand.Intn(12), rand.Float64()/2))
+	}
+	return graphs
+}
+
+// raízes a testar em cada grafo: todos os processos nos grafos pequenos; nos
+// demais, um processo sorteado e uma folha, se houver
+func tarryRoots(g *Graph) []string {
+	if len(g.Ids) <= 5 {
+		return g.Ids
+	}
+	roots := []string{g.Ids[rand.Intn(len(g.Ids))]}
+	for _, id := range g.Ids {
+		if len(g.Adj[id]) == 1 {
+			return append(roots, id)
+		}
+	}
+	return roots
+}
+
+// confere as propriedades da travessia: o token sai da raiz e volta para ela,
+// passa por cada aresta exatamente uma vez em cada sentido (2|E| mensagens) e
+// a árvore cobre todos os processos usando apenas arestas do grafo
+func checkTraversal(g *Graph, tree *SpanningTree) []string {
+	errs := make([]string, 0)
+	route := tree.Route
+	if route[0] != tree.Root || route[len(route)-1] != tree.Root {
+		errs = append(errs, fmt.Sprintf("a rota não começa e termina em %s: %v", tree.Root, route))
+	}
+	if len(route)-1 != 2*g.edges() {
+		errs = append(errs, fmt.Sprintf("%d mensagens, esperadas 2|E| = %d", len(route)-1, 2*g.edges()))
+	}
+	crossed := make(map[[2]string]int)
+	for i := 0; i+1 < len(route); i++ {
+		crossed[[2]string{route[i], route[i+1]}]++
+	}
+	for _, a := range g.Ids {
+		for _, b := range g.Adj[a] {
+			if n := crossed[[2]string{a, b}]; n != 1 {
+				errs = append(errs, fmt.Sprintf("o token passou %d vezes de %s para %s", n, a, b))
+			}
+			delete(crossed, [2]string{a, b})
+		}
+	}
+	for hop := range crossed {
+		errs = append(errs, fmt.Sprintf("o token passou de %s para %s, que não são vizinhos", hop[0], hop[1]))
+	}
+	for _, id := range g.Ids {
+		parent, ok := tree.Parent[id]
+		switch {
+		case id == tree.Root && ok:
+			errs = append(errs, fmt.Sprintf("a raiz %s tem pai %s", id, parent))
+		case id != tree.Root && !ok:
+			errs = append(errs, fmt.Sprintf("%s não entrou na árvore", id))
+		case ok && tree.Depth[id] != tree.Depth[parent]+1:
+			errs = append(errs, fmt.Sprintf("profundidade de %s inconsistente com a de %s", id, parent))
+		}
+	}
+	return errs
+}
+
+// indica se a é ancestral de b na árvore
+func (t *SpanningTree) ancestor(a, b string) bool {
+	for b != t.Root {
+		b = t.Parent[b]
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// confere as propriedades das buscas em profundidade: o token só percorre as
+// arestas da árvore (2(|V|-1) passagens, saindo e voltando à raiz), toda aresta
+// do grafo liga um processo a um ancestral e há no máximo 4|E| mensagens
+func checkDepthFirst(g *Graph, tree *SpanningTree, c *Stats) []string {
+	errs := make([]string, 0)
+	route := tree.Route
+	if route[0] != tree.Root || route[len(route)-1] != tree.Root {
+		errs = append(errs, fmt.Sprintf("a rota não começa e termina em %s: %v", tree.Root, route))
+	}
+	if len(route)-1 != 2*(len(g.Ids)-1) {
+		errs = append(errs, fmt.Sprintf("o token passou %d vezes, esperadas 2(|V|-1) = %d", len(route)-1, 2*(len(g.Ids)-1)))
+	}
+	for i := 0; i+1 < len(route); i++ {
+		a, b := route[i], route[i+1]
+		if tree.Parent[a] != b && tree.Parent[b] != a {
+			errs = append(errs, fmt.Sprintf("o token passou de %s para %s fora da árvore", a, b))
+		}
+	}
+	for _, id := range g.Ids {
+		if _, ok := tree.Parent[id]; id != tree.Root && !ok {
+			errs = append(errs, fmt.Sprintf("%s não entrou na árvore", id))
+		}
+		for _, next := range g.Adj[id] {
+			if id < next && !tree.ancestor(id, next) && !tree.ancestor(next, id) {
+				errs = append(errs, fmt.Sprintf("a aresta %s-%s liga ramos diferentes da árvore", id, next))
+			}
+		}
+	}
+	if c.Messages > 4*g.edges() {
+		errs = append(errs, fmt.Sprintf("%d mensagens, mais que 4|E| = %d", c.Messages, 4*g.edges()))
+	}
+	return errs
+}
+
+// confere as medidas de qualquer execução: toda mensagem enviada foi recebida,
+// só há mensagens entre vizinhos e as contagens por canal e por processo somam
+// o total
+func checkDelivery(g *Graph, stats *Stats) []string {
+	errs := make([]string, 0)
+	sent, received, perLink := 0, 0, 0
+	for _, id := range g.Ids {
+		sent += stats.Sent[id]
+		received += stats.Received[id]
+	}
+	for link, n := range stats.PerLink {
+		perLink += n
+		neighbours := false
+		for _, next := range g.Adj[link.From] {
+			neighbours = neighbours || next == link.To
+		}
+		if !neighbours {
+			errs = append(errs, fmt.Sprintf("mensagem de %s para %s, que não são vizinhos", link.From, link.To))
+		}
+	}
+	if sent != stats.Messages || received != stats.Messages || perLink != stats.Messages {
+		errs = append(errs, fmt.Sprintf("%d mensagens, mas %d enviadas, %d recebidas e %d nos canais", stats.Messages, sent, received, perLink))
+	}
+	return errs
+}
+
+// confere a onda Echo: a árvore cobre todos os processos, há exatamente 2|E|
+// mensagens e o resultado é igual à agregação feita diretamente sobre os valores
+func checkEcho(g *Graph, t *Traversal) []string {
+	errs := make([]string, 0)
+	for _, id := range g.Ids {
+		if _, ok := t.Tree.Parent[id]; id != t.Tree.Root && !ok {
+			errs = append(errs, fmt.Sprintf("%s não entrou na árvore", id))
+		}
+	}
+	if t.Stats.Messages != 2*g.edges() {
+		errs = append(errs, fmt.Sprintf("%d mensagens, esperadas 2|E| = %d", t.Stats.Messages, 2*g.edges()))
+	}
+	expected := t.Aggregator.Start(g.Ids[0], g.Values[g.Ids[0]])
+	for _, id := range g.Ids[1:] {
+		expected = t.Aggregator.Merge(expected, t.Aggregator.Start(id, g.Values[id]))
+	}
+	if fmt.Sprint(expected) != fmt.Sprint(t.Result) {
+		errs = append(errs, fmt.Sprintf("resultado %v, esperado %v", t.Result, expected))
+	}
+	return errs
+}
+
+func TestTarryCrossesEachEdgeOncePerDirection(t *testing.T) {
+	for i, g := range tarryGraphs() {
+		// parte das execuções atrasa as mensagens para variar a ordem de entrega
+		delay := time.Duration(0)
+		if i%4 == 3 {
+			delay = 100 * time.Microsecond
+		}
+		for _, root := range tarryRoots(g) {
+			tr, err := g.traverse("tarry", root, delay, aggregators["sum"], true)
+			if err != nil {
+				t.Fatalf("raiz %s: %v", root, err)
+			}
+			if errs := checkTraversal(g, tr.Tree); len(errs) > 0 {
+				t.Errorf("%d processos, %d arestas, raiz %s:\n  %s", len(g.Ids), g.edges(), root, strings.Join(errs, "\n  "))
+			}
+		}
+	}
+}
+
+// Tarry troca exatamente 2|E| mensagens, uma em cada canal, e cada uma só é
+// enviada depois de a anterior chegar, então a profundidade causal também é 2|E|
+func TestTarryMessageBound(t *testing.T) {
+	for _, g := range tarryGraphs() {
+		for _, root := range tarryRoots(g) {
+			tr, err := g.traverse("tarry", root, 0, aggregators["sum"], true)
+			if err != nil {
+				t.Fatalf("raiz %s: %v", root, err)
+			}
+			s, bound := tr.Stats, 2*g.edges()
+			if s.Messages != bound || s.ByKind[TokenMsg] != bound || s.Depth != bound {
+				t.Errorf("raiz %s: %d mensagens (%d tokens), profundidade causal %d, esperadas 2|E| = %d", root, s.Messages, s.ByKind[TokenMsg], s.Depth, bound)
+			}
+			for _, a := range g.Ids {
+				for _, b := range g.Adj[a] {
+					if n := s.PerLink[Link{a, b}]; n != 1 {
+						t.Errorf("raiz %s: %d mensagens no canal %s -> %s", root, n, a, b)
+					}
+				}
+				if s.Sent[a] != len(g.Adj[a]) || s.Received[a] != len(g.Adj[a]) {
+					t.Errorf("raiz %s: %s enviou %d e recebeu %d mensagens, mas tem %d vizinhos", root, a, s.Sent[a], s.Received[a], len(g.Adj[a]))
+				}
+			}
+			if errs := checkDelivery(g, s); len(errs) > 0 {
+				t.Errorf("raiz %s:\n  %s", root, strings.Join(errs, "\n  "))
+			}
+		}
+	}
+}
+
+// as buscas em profundidade de Awerbuch e de Cidon, com e sem atraso: com
+// atraso os avisos de visita podem chegar depois do token (Cidon descarta esses tokens)
+func TestDepthFirst(t *testing.T) {
+	for i, g := range tarryGraphs() {
+		delays := []time.Duration{0}
+		if i%4 == 3 {
+			delays = append(delays, 100*time.Microsecond)
+		}
+		for _, root := range tarryRoots(g) {
+			for _, alg := range []string{"awerbuch", "cidon"} {
+				for _, delay := range delays {
+					tr, err := g.traverse(alg, root, delay, aggregators["sum"], true)
+					if err != nil {
+						t.Fatalf("%s, raiz %s: %v", alg, root, err)
+					}
+					errs := append(checkDepthFirst(g, tr.Tree, tr.Stats), checkDelivery(g, tr.Stats)...)
+					if len(errs) > 0 {
+						t.Errorf("%s com atraso %v, %d processos, %d arestas, raiz %s:\n  %s", alg, delay, len(g.Ids), g.edges(), root, strings.Join(errs, "\n  "))
+					}
+				}
+			}
+		}
+	}
+}
+
+// a onda Echo troca exatamente 2|E| mensagens (um explore ou um echo em cada
+// sentido de cada aresta) e entrega ao iniciador a mesma agregação feita
+// diretamente sobre os valores
+func TestEcho(t *testing.T) {
+	for i, g := range tarryGraphs() {
+		delay := time.Duration(0)
+		if i%4 == 3 {
+			delay = 100 * time.Microsecond
+		}
+		for _, root := range tarryRoots(g) {
+			for _, name := range []string{"sum", "min", "max", "count", "ids"} {
+				tr, err := g.traverse("echo", root, delay, aggregators[name], true)
+				if err != nil {
+					t.Fatalf("%s, raiz %s: %v", name, root, err)
+				}
+				errs := append(checkEcho(g, tr), checkDelivery(g, tr.Stats)...)
+				if len(errs) > 0 {
+					t.Errorf("%s, %d processos, %d arestas, raiz %s:\n  %s", name, len(g.Ids), g.edges(), root, strings.Join(errs, "\n  "))
+				}
+			}
+		}
+	}
+}